@@ -27,15 +27,48 @@ import (
 type ConfigFile struct {
 	Port int `yaml:"port"`
 
+	TrustedProxies []string `yaml:"trustedProxies"` // addresses or CIDR ranges whose forwarding information is believed
+	ProxyHeader    string   `yaml:"proxyHeader"`    // "X-Forwarded-For", "X-Real-IP" or "Forwarded"
+	ProxyProtocol  bool     `yaml:"proxyProtocol"`  // expect a PROXY protocol header on connections from trusted proxies
+
+	IdentityMode    string `yaml:"identityMode"`    // store posters by "ip" address or by a keyed "hmac" of it
+	PosterRetention int    `yaml:"posterRetention"` // in days, forget who made posts and drop inactive posters after this, 0 to keep forever
+
 	SiteName    string   `yaml:"siteName"`
+	SiteURL     string   `yaml:"siteURL"` // public address of the board for links in feeds, empty to use the request's host
 	SiteSlogans []string `yaml:"siteSlogans"`
 	SiteRules   []string `yaml:"siteRules"`
 
-	AdminPassword string `yaml:"adminPassword"`
+	AdminPassword string `yaml:"adminPassword"` // deprecated, creates an "admin" account if none exist
 	AdminPostOnly bool   `yaml:"adminPostOnly"`
-
-	PostCooldown  int `yaml:"postCooldown"` // in seconds
-	LoginCooldown int `yaml:"loginCooldown"`
+	Moderation    string `yaml:"moderation"` // hold "threads", "all" posts or posts from "new" posters without a live post for approval
+
+	Captcha          string            `yaml:"captcha"` // require a captcha for "threads", "replies", "all" posts or "new" posters
+	CaptchaQuestions []CaptchaQuestion `yaml:"captchaQuestions"`
+	PublicModLog     bool              `yaml:"publicModLog"`
+	APIOrigins       []string          `yaml:"apiOrigins"` // origins allowed to read the api from browsers, "*" for any
+
+	ProofOfWork      bool `yaml:"proofOfWork"`
+	PowDifficulty    int  `yaml:"powDifficulty"`    // leading zero bits required when the board is quiet
+	PowMaxDifficulty int  `yaml:"powMaxDifficulty"` // cap as recent post volume raises the difficulty
+
+	FloodWindow   int    `yaml:"floodWindow"`   // in seconds
+	FloodThreads  int    `yaml:"floodThreads"`  // threads allowed across all posters per window, 0 to disable
+	FloodReplies  int    `yaml:"floodReplies"`  // replies allowed across all posters per window, 0 to disable
+	FloodMode     string `yaml:"floodMode"`     // when exceeded require a "captcha" for everyone, disable new "threads" or only let "staff" post
+	FloodCooldown int    `yaml:"floodCooldown"` // in minutes
+
+	Blocklists      []Blocklist `yaml:"blocklists"`
+	BlocklistServer string      `yaml:"blocklistServer"` // "host:port" of the DNS server to query, empty for the system resolver
+	BlocklistCache  int         `yaml:"blocklistCache"`  // in minutes
+	TorExitList     string      `yaml:"torExitList"`     // file of Tor exit addresses, one per line
+	TorExitURL      string      `yaml:"torExitURL"`      // download the exit list from here, empty to manage the file yourself
+	TorExitRefresh  int         `yaml:"torExitRefresh"`  // in minutes
+	TorExitAction   string      `yaml:"torExitAction"`   // "block", "captcha" or "hold"
+
+	PostCooldown   int `yaml:"postCooldown"` // in seconds
+	LoginCooldown  int `yaml:"loginCooldown"`
+	ReportCooldown int `yaml:"reportCooldown"`
 
 	MaxPostsPerPage int `yaml:"maxPostsPerPage"`
 	MaxPages        int `yaml:"maxPages"`
@@ -44,7 +77,32 @@ type ConfigFile struct {
 	MaxNameSize    int     `yaml:"maxNameSize"`
 	MaxSubjectSize int     `yaml:"maxSubjectSize"`
 	MaxCommentSize int     `yaml:"maxCommentSize"`
+	MaxAltSize     int     `yaml:"maxAltSize"`    // 0 for the default of 200
 	MaxUploadSize  float32 `yaml:"maxUploadSize"` // in megabytes
+
+	MediaStore  string `yaml:"mediaStore"` // "local" or "s3"
+	S3Endpoint  string `yaml:"s3Endpoint"`
+	S3Region    string `yaml:"s3Region"`
+	S3Bucket    string `yaml:"s3Bucket"`
+	S3AccessKey string `yaml:"s3AccessKey"`
+	S3SecretKey string `yaml:"s3SecretKey"`
+	S3PublicURL string `yaml:"s3PublicURL"` // serve media from here, hidden posts link through tanuki but their objects stay public
+
+	GCInterval int `yaml:"gcInterval"` // in minutes, 0 to disable
+
+	DeleteRetention int `yaml:"deleteRetention"` // in days, deleted posts can be restored until then, 0 for the default of 7
+}
+
+// CaptchaQuestion is a text alternative to the captcha image
+type CaptchaQuestion struct {
+	Question string   `yaml:"question"`
+	Answers  []string `yaml:"answers"`
+}
+
+// Blocklist is a DNSBL zone and what to do with posts from addresses it lists
+type Blocklist struct {
+	Zone   string `yaml:"zone"`
+	Action string `yaml:"action"` // "block", "captcha" or "hold", the form shows captchas to everyone while any list uses "captcha"
 }
 
 var Config ConfigFile
@@ -62,5 +120,19 @@ func InitConfig(path string) error {
 		return err
 	}
 
+	// options added since older config files were written
+	if Config.MaxAltSize == 0 {
+		Config.MaxAltSize = 200
+	}
+	if Config.DeleteRetention == 0 {
+		Config.DeleteRetention = 7
+	}
+	if Config.BlocklistCache == 0 {
+		Config.BlocklistCache = 60
+	}
+	if Config.TorExitRefresh == 0 {
+		Config.TorExitRefresh = 60
+	}
+
 	return nil
 }
@@ -0,0 +1,86 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnknownAccount = errors.New("unknown account")
+
+type Role string
+
+const (
+	RoleJanitor   Role = "janitor"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var Roles = []Role{RoleJanitor, RoleModerator, RoleAdmin}
+
+func (r Role) IsValid() bool {
+	return r == RoleJanitor || r == RoleModerator || r == RoleAdmin
+}
+
+func (r Role) CanDelete() bool {
+	return r == RoleJanitor || r == RoleModerator || r == RoleAdmin
+}
+
+func (r Role) CanBan() bool {
+	return r == RoleModerator || r == RoleAdmin
+}
+
+func (r Role) CanUnban() bool {
+	return r == RoleModerator || r == RoleAdmin
+}
+
+func (r Role) CanConfig() bool {
+	return r == RoleAdmin
+}
+
+type Account struct {
+	Role     Role      `json:"role"`
+	Password []byte    `json:"password"` // bcrypt hash
+	Created  time.Time `json:"created,omitzero"`
+}
+
+func NewAccount(role Role, password string) (Account, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return Account{}, err
+	}
+
+	return Account{Role: role, Password: hash, Created: time.Now()}, nil
+}
+
+func (a Account) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword(a.Password, []byte(password)) == nil
+}
+
+type AccountData map[string]Account
+
+type AccountDB interface {
+	Get(name string) (Account, error)
+	GetAll() (AccountData, error)
+	Add(name string, account Account) error
+	Delete(name string) error
+}
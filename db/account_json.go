@@ -0,0 +1,144 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+type AccountJSON struct {
+	file string
+	mtx  sync.RWMutex
+}
+
+func NewAccountJSON(file string) *AccountJSON {
+	return &AccountJSON{file: file}
+}
+
+func (a *AccountJSON) read() (AccountData, error) {
+	f, err := os.Open(a.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(AccountData), nil
+		}
+
+		return nil, fmt.Errorf("failed to open accounts file: %w", err)
+	}
+
+	defer f.Close()
+
+	accounts := make(AccountData)
+	err = json.NewDecoder(f).Decode(&accounts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode accounts file: %w", err)
+	}
+
+	return accounts, nil
+}
+
+func (a *AccountJSON) write(accounts AccountData) error {
+	f, err := os.OpenFile(a.file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open accounts file: %w", err)
+	}
+
+	defer f.Close()
+
+	err = json.NewEncoder(f).Encode(accounts)
+	if err != nil {
+		return fmt.Errorf("failed to encode accounts file: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AccountJSON) Get(name string) (Account, error) {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+
+	accounts, err := a.read()
+	if err != nil {
+		return Account{}, fmt.Errorf("failed to fetch accounts: %w", err)
+	}
+
+	account, ok := accounts[name]
+	if !ok {
+		return Account{}, ErrUnknownAccount
+	}
+
+	return account, nil
+}
+
+func (a *AccountJSON) GetAll() (AccountData, error) {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+
+	accounts, err := a.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+func (a *AccountJSON) Add(name string, account Account) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	accounts, err := a.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch accounts: %w", err)
+	}
+
+	accounts[name] = account
+
+	err = a.write(accounts)
+	if err != nil {
+		return fmt.Errorf("failed to insert account: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AccountJSON) Delete(name string) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	accounts, err := a.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch accounts: %w", err)
+	}
+
+	_, ok := accounts[name]
+	if !ok {
+		return ErrUnknownAccount
+	}
+
+	delete(accounts, name)
+
+	err = a.write(accounts)
+	if err != nil {
+		return fmt.Errorf("failed to delete account: %w", err)
+	}
+
+	return nil
+}
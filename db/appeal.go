@@ -0,0 +1,58 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrUnknownAppeal = errors.New("unknown appeal")
+
+type AppealStatus string
+
+const (
+	AppealPending  AppealStatus = "pending"
+	AppealAccepted AppealStatus = "accepted"
+	AppealDenied   AppealStatus = "denied"
+)
+
+type Appeal struct {
+	BanTime   time.Time    `json:"banTime"` // start of the ban being appealed
+	Time      time.Time    `json:"time"`
+	Text      string       `json:"text"`
+	Status    AppealStatus `json:"status"`
+	Response  string       `json:"response,omitempty"`
+	Responder string       `json:"responder,omitempty"`
+	Resolved  time.Time    `json:"resolved,omitzero"`
+}
+
+func (a Appeal) IsPending() bool {
+	return a.Status == AppealPending
+}
+
+// AppealData maps poster ids to their most recent appeal
+type AppealData map[string]Appeal
+
+type AppealDB interface {
+	Get(id string) (Appeal, error)
+	GetPending() (AppealData, error)
+	Add(id string, appeal Appeal) error
+	Forget(before time.Time) (int, error) // removes appeals resolved before before, their posters can appeal again
+}
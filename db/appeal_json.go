@@ -0,0 +1,160 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type AppealJSON struct {
+	file string
+	mtx  sync.RWMutex
+}
+
+func NewAppealJSON(file string) *AppealJSON {
+	return &AppealJSON{file: file}
+}
+
+func (a *AppealJSON) read() (AppealData, error) {
+	f, err := os.Open(a.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(AppealData), nil
+		}
+
+		return nil, fmt.Errorf("failed to open appeals file: %w", err)
+	}
+
+	defer f.Close()
+
+	appeals := make(AppealData)
+	err = json.NewDecoder(f).Decode(&appeals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode appeals file: %w", err)
+	}
+
+	return appeals, nil
+}
+
+func (a *AppealJSON) write(appeals AppealData) error {
+	f, err := os.OpenFile(a.file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open appeals file: %w", err)
+	}
+
+	defer f.Close()
+
+	err = json.NewEncoder(f).Encode(appeals)
+	if err != nil {
+		return fmt.Errorf("failed to encode appeals file: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AppealJSON) Get(id string) (Appeal, error) {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+
+	appeals, err := a.read()
+	if err != nil {
+		return Appeal{}, fmt.Errorf("failed to fetch appeals: %w", err)
+	}
+
+	appeal, ok := appeals[id]
+	if !ok {
+		return Appeal{}, ErrUnknownAppeal
+	}
+
+	return appeal, nil
+}
+
+func (a *AppealJSON) GetPending() (AppealData, error) {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+
+	appeals, err := a.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch appeals: %w", err)
+	}
+
+	pending := make(AppealData)
+	for id, appeal := range appeals {
+		if !appeal.IsPending() {
+			continue
+		}
+
+		pending[id] = appeal
+	}
+
+	return pending, nil
+}
+
+func (a *AppealJSON) Add(id string, appeal Appeal) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	appeals, err := a.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch appeals: %w", err)
+	}
+
+	appeals[id] = appeal
+
+	err = a.write(appeals)
+	if err != nil {
+		return fmt.Errorf("failed to insert appeal: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AppealJSON) Forget(before time.Time) (int, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	appeals, err := a.read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch appeals: %w", err)
+	}
+
+	var forgotten int
+	for id, appeal := range appeals {
+		if appeal.IsPending() || !appeal.Resolved.Before(before) {
+			continue
+		}
+
+		delete(appeals, id)
+		forgotten++
+	}
+	if forgotten == 0 {
+		return 0, nil
+	}
+
+	err = a.write(appeals)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete appeals: %w", err)
+	}
+
+	return forgotten, nil
+}
@@ -0,0 +1,70 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppealForget(t *testing.T) {
+	a := NewAppealJSON(filepath.Join(t.TempDir(), "appeals.json"))
+
+	now := time.Now()
+	before := now.AddDate(0, 0, -30)
+
+	appeals := AppealData{
+		"pending":      {Time: now.AddDate(0, 0, -60), Status: AppealPending},
+		"old denied":   {Time: now.AddDate(0, 0, -60), Status: AppealDenied, Resolved: now.AddDate(0, 0, -45)},
+		"old accepted": {Time: now.AddDate(0, 0, -60), Status: AppealAccepted, Resolved: now.AddDate(0, 0, -40)},
+		"recent":       {Time: now.AddDate(0, 0, -60), Status: AppealDenied, Resolved: now.AddDate(0, 0, -1)},
+	}
+	for id, appeal := range appeals {
+		err := a.Add(id, appeal)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	forgotten, err := a.Forget(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forgotten != 2 {
+		t.Errorf("Forget = %d, want 2", forgotten)
+	}
+
+	tests := []struct {
+		id   string
+		kept bool
+	}{
+		{"pending", true},
+		{"old denied", false},
+		{"old accepted", false},
+		{"recent", true},
+	}
+
+	for _, tt := range tests {
+		_, err := a.Get(tt.id)
+		if kept := err == nil; kept != tt.kept {
+			t.Errorf("%s: kept = %t, want %t (%v)", tt.id, kept, tt.kept, err)
+		}
+	}
+}
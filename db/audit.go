@@ -0,0 +1,46 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"time"
+)
+
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor,omitempty"`
+	Action   string    `json:"action"`
+	Post     string    `json:"post,omitempty"`
+	Poster   string    `json:"poster,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Snapshot *Post     `json:"snapshot,omitempty"` // content of a deleted post
+}
+
+// Redacted returns a copy of the entry safe to show to the public
+func (e AuditEntry) Redacted() AuditEntry {
+	return AuditEntry{Time: e.Time, Action: e.Action, Post: e.Post, Reason: e.Reason}
+}
+
+type AuditData []AuditEntry
+
+type AuditDB interface {
+	GetAll() (AuditData, error)
+	Add(entry AuditEntry) error
+	Forget(before time.Time) (int, error)
+}
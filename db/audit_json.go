@@ -0,0 +1,153 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+type AuditJSON struct {
+	file string
+	mtx  sync.RWMutex
+}
+
+func NewAuditJSON(file string) *AuditJSON {
+	return &AuditJSON{file: file}
+}
+
+func (a *AuditJSON) read() (AuditData, error) {
+	f, err := os.Open(a.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+
+	defer f.Close()
+
+	var entries AuditData
+	err = json.NewDecoder(f).Decode(&entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode audit file: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (a *AuditJSON) write(entries AuditData) error {
+	f, err := os.OpenFile(a.file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+
+	defer f.Close()
+
+	err = json.NewEncoder(f).Encode(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit file: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AuditJSON) GetAll() (AuditData, error) {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+
+	entries, err := a.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch audit entries: %w", err)
+	}
+
+	// newest first
+	slices.Reverse(entries)
+
+	return entries, nil
+}
+
+func (a *AuditJSON) Add(entry AuditEntry) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	entries, err := a.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch audit entries: %w", err)
+	}
+
+	entries = append(entries, entry)
+
+	err = a.write(entries)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// Forget removes the poster ids and address ranges from entries made before the given time,
+// returning how many entries were changed
+func (a *AuditJSON) Forget(before time.Time) (int, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	entries, err := a.read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch audit entries: %w", err)
+	}
+
+	var forgotten int
+	for i, entry := range entries {
+		if !entry.Time.Before(before) {
+			continue
+		}
+
+		var changed bool
+		if entry.Poster != "" {
+			entries[i].Poster = ""
+			changed = true
+		}
+
+		if entry.Snapshot != nil && entry.Snapshot.hasPoster() {
+			snapshot := entry.Snapshot.WithoutPosters()
+			entries[i].Snapshot = &snapshot
+			changed = true
+		}
+
+		if changed {
+			forgotten++
+		}
+	}
+	if forgotten == 0 {
+		return 0, nil
+	}
+
+	err = a.write(entries)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update audit entries: %w", err)
+	}
+
+	return forgotten, nil
+}
@@ -0,0 +1,240 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"errors"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var ErrUnknownFilter = errors.New("unknown filter")
+
+type FilterAction string
+
+const (
+	FilterReplace FilterAction = "replace"
+	FilterHold    FilterAction = "hold"
+	FilterReject  FilterAction = "reject"
+	FilterBan     FilterAction = "ban"
+)
+
+// FilterActions is ordered from least to most severe
+var FilterActions = []FilterAction{FilterReplace, FilterHold, FilterReject, FilterBan}
+
+func (a FilterAction) IsValid() bool {
+	return slices.Contains(FilterActions, a)
+}
+
+// Severity ranks actions so the strictest matching filter wins
+func (a FilterAction) Severity() int {
+	return slices.Index(FilterActions, a)
+}
+
+type Filter struct {
+	Pattern     string        `json:"pattern"`
+	Regexp      bool          `json:"regexp,omitempty"`
+	Action      FilterAction  `json:"action"`
+	Replacement string        `json:"replacement,omitempty"`
+	Reason      string        `json:"reason,omitempty"`
+	BanDuration time.Duration `json:"banDuration,omitempty"` // zero for permanent bans
+	Created     time.Time     `json:"created"`
+
+	matcher *regexp.Regexp // compiled when loaded, see Compile
+}
+
+// Compile builds the filter's case-insensitive matcher. Patterns are normalized
+// the same way as the text they're matched against, for regular expressions
+// only their literal characters are.
+func (f Filter) Compile() (*regexp.Regexp, error) {
+	if !f.Regexp {
+		return regexp.Compile("(?i)" + regexp.QuoteMeta(Normalize(f.Pattern)))
+	}
+
+	re, err := syntax.Parse("(?i)"+f.Pattern, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+
+	foldRegexp(re)
+
+	return regexp.Compile(re.String())
+}
+
+// foldRegexp normalizes the literals of a parsed regular expression, character
+// classes gain the folded form of single characters but ranges are left alone
+func foldRegexp(re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		var folded []rune
+		for _, r := range re.Rune {
+			folded = append(folded, []rune(foldRune(r))...)
+		}
+
+		re.Rune = folded
+		if len(folded) == 0 {
+			re.Op = syntax.OpEmptyMatch
+		}
+	case syntax.OpCharClass:
+		for i := 0; i < len(re.Rune); i += 2 {
+			if re.Rune[i] != re.Rune[i+1] {
+				continue
+			}
+
+			folded := []rune(foldRune(re.Rune[i]))
+			if len(folded) == 1 && folded[0] != re.Rune[i] {
+				re.Rune = append(re.Rune, folded[0], folded[0])
+			}
+		}
+	}
+
+	for _, sub := range re.Sub {
+		foldRegexp(sub)
+	}
+}
+
+// Apply matches the filter against a normalized copy of text, so lookalike
+// characters and invisible padding don't evade it. Replace filters swap the
+// matched parts of the original text for the replacement.
+func (f Filter) Apply(text string) (string, bool, error) {
+	re := f.matcher
+	if re == nil {
+		var err error
+		re, err = f.Compile()
+		if err != nil {
+			return text, false, err
+		}
+	}
+
+	normal, spans := normalize(text)
+
+	matches := re.FindAllStringIndex(normal, -1)
+	matches = slices.DeleteFunc(matches, func(m []int) bool { return m[0] == m[1] })
+	if len(matches) == 0 {
+		return text, false, nil
+	}
+	if f.Action != FilterReplace {
+		return text, true, nil
+	}
+
+	var b strings.Builder
+	var last int
+	for _, m := range matches {
+		start, end := spans[m[0]][0], spans[m[1]-1][1]
+		if start < last {
+			continue
+		}
+
+		b.WriteString(text[last:start])
+		b.WriteString(f.Replacement)
+		last = end
+	}
+
+	b.WriteString(text[last:])
+
+	return b.String(), true, nil
+}
+
+// Normalize folds text for filtering: compatibility forms are decomposed,
+// accents and invisible characters dropped, common Cyrillic and Greek
+// lookalikes mapped to Latin letters and everything lowercased
+func Normalize(text string) string {
+	normal, _ := normalize(text)
+
+	return normal
+}
+
+// normalize folds text and returns, for each byte of the result, the range of
+// bytes in text it came from
+func normalize(text string) (string, [][2]int) {
+	var b strings.Builder
+	var spans [][2]int
+
+	for i, r := range text {
+		span := [2]int{i, i + utf8.RuneLen(r)}
+		if r == utf8.RuneError {
+			span[1] = i + 1
+		}
+
+		folded := foldRune(r)
+
+		b.WriteString(folded)
+		for range len(folded) {
+			spans = append(spans, span)
+		}
+	}
+
+	return b.String(), spans
+}
+
+func foldRune(r rune) string {
+	if unicode.Is(unicode.Cf, r) {
+		return "" // zero width spaces and joiners, soft hyphens, bidi controls
+	}
+
+	var b strings.Builder
+	for _, c := range norm.NFKD.String(string(r)) {
+		if unicode.Is(unicode.Mn, c) {
+			continue
+		}
+
+		if h, ok := homoglyphs[c]; ok {
+			c = h
+		}
+
+		b.WriteRune(unicode.ToLower(c))
+	}
+
+	return b.String()
+}
+
+// homoglyphs maps letters that are commonly swapped in for Latin ones
+var homoglyphs = map[rune]rune{
+	// cyrillic
+	'а': 'a', 'А': 'a', 'в': 'b', 'В': 'b', 'с': 'c', 'С': 'c', 'ԁ': 'd',
+	'е': 'e', 'Е': 'e', 'һ': 'h', 'н': 'h', 'Н': 'h', 'і': 'i', 'І': 'i',
+	'ј': 'j', 'Ј': 'j', 'к': 'k', 'К': 'k', 'м': 'm', 'М': 'm', 'о': 'o',
+	'О': 'o', 'р': 'p', 'Р': 'p', 'ԛ': 'q', 'ѕ': 's', 'Ѕ': 's', 'т': 't',
+	'Т': 't', 'у': 'y', 'У': 'y', 'ү': 'y', 'ԝ': 'w', 'х': 'x', 'Х': 'x',
+
+	// greek
+	'α': 'a', 'Α': 'a', 'Β': 'b', 'ε': 'e', 'Ε': 'e', 'Η': 'h', 'ι': 'i',
+	'Ι': 'i', 'κ': 'k', 'Κ': 'k', 'Μ': 'm', 'Ν': 'n', 'ν': 'v', 'ο': 'o',
+	'Ο': 'o', 'ρ': 'p', 'Ρ': 'p', 'τ': 't', 'Τ': 't', 'υ': 'u', 'Υ': 'y',
+	'χ': 'x', 'Χ': 'x', 'Ζ': 'z',
+
+	// latin
+	'ı': 'i', 'ɡ': 'g',
+}
+
+// FilterData holds filters in the order they were added
+type FilterData []Filter
+
+type FilterDB interface {
+	GetAll() (FilterData, error)
+	Add(filter Filter) error
+	Delete(pattern string) error
+}
@@ -0,0 +1,168 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+)
+
+type FilterJSON struct {
+	file string
+	mtx  sync.RWMutex
+
+	// matchers are compiled once per pattern rather than for every post
+	matchers   map[matcherKey]*regexp.Regexp
+	matcherMtx sync.Mutex
+}
+
+type matcherKey struct {
+	pattern string
+	regexp  bool
+}
+
+func NewFilterJSON(file string) *FilterJSON {
+	return &FilterJSON{file: file}
+}
+
+func (f *FilterJSON) read() (FilterData, error) {
+	file, err := os.Open(f.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to open filters file: %w", err)
+	}
+
+	defer file.Close()
+
+	var filters FilterData
+	err = json.NewDecoder(file).Decode(&filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode filters file: %w", err)
+	}
+
+	f.compile(filters)
+
+	return filters, nil
+}
+
+// compile attaches a matcher to each filter, reusing those compiled before and
+// dropping those of filters that no longer exist
+func (f *FilterJSON) compile(filters FilterData) {
+	f.matcherMtx.Lock()
+	defer f.matcherMtx.Unlock()
+
+	matchers := make(map[matcherKey]*regexp.Regexp)
+	for i, filter := range filters {
+		key := matcherKey{filter.Pattern, filter.Regexp}
+
+		re, ok := f.matchers[key]
+		if !ok {
+			var err error
+			re, err = filter.Compile()
+			if err != nil {
+				continue // Apply reports the error
+			}
+		}
+
+		matchers[key] = re
+		filters[i].matcher = re
+	}
+
+	f.matchers = matchers
+}
+
+func (f *FilterJSON) write(filters FilterData) error {
+	file, err := os.OpenFile(f.file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open filters file: %w", err)
+	}
+
+	defer file.Close()
+
+	err = json.NewEncoder(file).Encode(filters)
+	if err != nil {
+		return fmt.Errorf("failed to encode filters file: %w", err)
+	}
+
+	return nil
+}
+
+func (f *FilterJSON) GetAll() (FilterData, error) {
+	f.mtx.RLock()
+	defer f.mtx.RUnlock()
+
+	filters, err := f.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch filters: %w", err)
+	}
+
+	return filters, nil
+}
+
+// Add appends a filter, replacing any existing filter with the same pattern
+func (f *FilterJSON) Add(filter Filter) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	filters, err := f.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch filters: %w", err)
+	}
+
+	filters = slices.DeleteFunc(filters, func(e Filter) bool { return e.Pattern == filter.Pattern })
+	filters = append(filters, filter)
+
+	err = f.write(filters)
+	if err != nil {
+		return fmt.Errorf("failed to insert filter: %w", err)
+	}
+
+	return nil
+}
+
+func (f *FilterJSON) Delete(pattern string) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	filters, err := f.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch filters: %w", err)
+	}
+
+	i := slices.IndexFunc(filters, func(e Filter) bool { return e.Pattern == pattern })
+	if i == -1 {
+		return ErrUnknownFilter
+	}
+
+	filters = slices.Delete(filters, i, i+1)
+
+	err = f.write(filters)
+	if err != nil {
+		return fmt.Errorf("failed to delete filter: %w", err)
+	}
+
+	return nil
+}
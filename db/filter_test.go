@@ -0,0 +1,107 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"ascii", "Hello World", "hello world"},
+		{"cyrillic", "ѕрам саsіno", "spam casino"},
+		{"cyrillic capitals", "СНЕАР", "cheap"},
+		{"greek", "VΙAGRA κοτ", "viagra kot"},
+		{"fullwidth", "ｓｐａｍ１２", "spam12"},
+		{"ligature", "ﬁne", "fine"},
+		{"precomposed accents", "café naïve", "cafe naive"},
+		{"combining accents", "cafe\u0301", "cafe"},
+		{"zero width space", "s\u200bp\u200ba\u200bm", "spam"},
+		{"soft hyphen", "sp\u00adam", "spam"},
+		{"bidi controls", "\u202espam\u202c\u2066x\u2069", "spamx"},
+		{"joiners", "sp\u200dam\ufeff", "spam"},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("%s: Normalize(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFilterApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  Filter
+		in      string
+		want    string
+		matched bool
+	}{
+		{"plain", Filter{Pattern: "spam", Action: FilterReplace, Replacement: "[x]"}, "buy spam now", "buy [x] now", true},
+		{"no match", Filter{Pattern: "spam", Action: FilterReplace, Replacement: "[x]"}, "buy eggs now", "buy eggs now", false},
+		{"case", Filter{Pattern: "SPAM", Action: FilterReplace, Replacement: "[x]"}, "Spam spam", "[x] [x]", true},
+		{"cyrillic", Filter{Pattern: "spam", Action: FilterReplace, Replacement: "[x]"}, "buy ѕрам now", "buy [x] now", true},
+		{"greek", Filter{Pattern: "viagra", Action: FilterReplace, Replacement: "[x]"}, "cheap VΙAGRA!", "cheap [x]!", true},
+		{"fullwidth", Filter{Pattern: "spam", Action: FilterReplace, Replacement: "[x]"}, "ｓｐａｍ and spam", "[x] and [x]", true},
+		{"accented", Filter{Pattern: "spam", Action: FilterReplace, Replacement: "[x]"}, "spám!", "[x]!", true},
+		{"combining accent inside", Filter{Pattern: "spam", Action: FilterReplace, Replacement: "[x]"}, "spa\u0301m!", "[x]!", true},
+		{"zero width padding", Filter{Pattern: "spam", Action: FilterReplace, Replacement: "[x]"}, "a s\u200bp\u200ba\u200bm b", "a [x] b", true},
+		{"soft hyphen", Filter{Pattern: "spam", Action: FilterReplace, Replacement: "[x]"}, "sp\u00adam", "[x]", true},
+		{"bidi padding", Filter{Pattern: "spam", Action: FilterReplace, Replacement: "[x]"}, "x \u202espam\u202c y", "x \u202e[x]\u202c y", true},
+		{"accented pattern", Filter{Pattern: "café", Action: FilterReplace, Replacement: "[x]"}, "Cafe café", "[x] [x]", true},
+		{"regexp", Filter{Pattern: `sp[a4]+m`, Regexp: true, Action: FilterReplace, Replacement: "[x]"}, "sp44m spaam", "[x] [x]", true},
+		{"regexp lookalikes", Filter{Pattern: `sp[a4]m`, Regexp: true, Action: FilterReplace, Replacement: "[x]"}, "ѕр4м", "[x]", true},
+		{"regexp accented literal", Filter{Pattern: `caf(é|e)s?`, Regexp: true, Action: FilterReplace, Replacement: "[x]"}, "CAFÉS", "[x]", true},
+		{"regexp cyrillic literal", Filter{Pattern: `саsino\d*`, Regexp: true, Action: FilterReplace, Replacement: "[x]"}, "casino777", "[x]", true},
+		{"regexp cyrillic class", Filter{Pattern: `b[оа]t`, Regexp: true, Action: FilterReplace, Replacement: "[x]"}, "bat bot", "[x] [x]", true},
+		{"regexp fullwidth literal", Filter{Pattern: `ｓｐａｍ`, Regexp: true, Action: FilterReplace, Replacement: "[x]"}, "spam", "[x]", true},
+		{"hold", Filter{Pattern: "spam", Action: FilterHold}, "buy ѕрам now", "buy ѕрам now", true},
+		{"reject", Filter{Pattern: "spam", Action: FilterReject}, "eggs", "eggs", false},
+	}
+
+	for _, tt := range tests {
+		got, matched, err := tt.filter.Apply(tt.in)
+		if err != nil {
+			t.Errorf("%s: Apply(%q): %s", tt.name, tt.in, err)
+			continue
+		}
+		if got != tt.want || matched != tt.matched {
+			t.Errorf("%s: Apply(%q) = %q, %t, want %q, %t", tt.name, tt.in, got, matched, tt.want, tt.matched)
+		}
+	}
+}
+
+func TestFilterCompileInvalid(t *testing.T) {
+	_, err := Filter{Pattern: "sp(am", Regexp: true}.Compile()
+	if err == nil {
+		t.Error("Compile of an invalid regexp succeeded")
+	}
+
+	_, _, err = Filter{Pattern: "sp(am", Regexp: true}.Apply("spam")
+	if err == nil {
+		t.Error("Apply of an invalid regexp succeeded")
+	}
+
+	_, err = Filter{Pattern: "sp(am"}.Compile()
+	if err != nil {
+		t.Errorf("Compile of a plain pattern with regexp syntax: %s", err)
+	}
+}
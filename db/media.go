@@ -0,0 +1,100 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var ErrUnknownMedia = errors.New("unknown media")
+
+type MediaFile struct {
+	Name     string
+	Modified time.Time
+}
+
+type MediaStore interface {
+	Put(name string, r io.Reader) error
+	Get(name string) (io.ReadSeekCloser, MediaFile, error)
+	Delete(name string) error
+	List(dir string) ([]MediaFile, error)
+	URL(name string) string
+}
+
+type MediaReport struct {
+	Removed []string // files no post referenced
+	Missing []string // files referenced by a post that don't exist
+}
+
+// CollectMedia removes files in the full and thumb directories that no post
+// references. Files modified within grace are kept so that uploads which
+// haven't been added to the post store yet survive.
+func CollectMedia(posts PostDB, media MediaStore, grace time.Duration) (MediaReport, error) {
+	var report MediaReport
+
+	all, err := posts.GetAll()
+	if err != nil {
+		return report, fmt.Errorf("failed to fetch posts: %w", err)
+	}
+
+	referenced := make(map[string]bool)
+	for _, thread := range all {
+		for _, post := range append([]Post{thread}, thread.Replies...) {
+			if !post.Image {
+				continue
+			}
+
+			referenced[post.FullPath()] = true
+			referenced[post.ThumbPath()] = true
+		}
+	}
+
+	for _, dir := range []string{"full", "thumb"} {
+		files, err := media.List(dir)
+		if err != nil {
+			return report, fmt.Errorf("failed to list %s images: %w", dir, err)
+		}
+
+		for _, file := range files {
+			if referenced[file.Name] {
+				delete(referenced, file.Name)
+				continue
+			}
+			if time.Since(file.Modified) < grace {
+				continue
+			}
+
+			err = media.Delete(file.Name)
+			if err != nil && err != ErrUnknownMedia {
+				return report, fmt.Errorf("failed to delete orphaned file: %w", err)
+			}
+
+			report.Removed = append(report.Removed, file.Name)
+		}
+	}
+
+	for name := range referenced {
+		report.Missing = append(report.Missing, name)
+	}
+
+	return report, nil
+}
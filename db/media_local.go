@@ -0,0 +1,150 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+var errInvalidMediaName = errors.New("invalid media name")
+
+type MediaLocal struct {
+	dir string
+}
+
+func NewMediaLocal(dir string) *MediaLocal {
+	return &MediaLocal{dir: dir}
+}
+
+func (m *MediaLocal) path(name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if !filepath.IsLocal(name) {
+		return "", errInvalidMediaName
+	}
+
+	return filepath.Join(m.dir, name), nil
+}
+
+func (m *MediaLocal) Put(name string, r io.Reader) error {
+	p, err := m.path(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *MediaLocal) Get(name string) (io.ReadSeekCloser, MediaFile, error) {
+	p, err := m.path(name)
+	if err != nil {
+		return nil, MediaFile{}, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, MediaFile{}, ErrUnknownMedia
+		}
+
+		return nil, MediaFile{}, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, MediaFile{}, err
+	}
+
+	return f, MediaFile{Name: name, Modified: info.ModTime()}, nil
+}
+
+func (m *MediaLocal) Delete(name string) error {
+	p, err := m.path(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrUnknownMedia
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (m *MediaLocal) List(dir string) ([]MediaFile, error) {
+	p, err := m.path(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var files []MediaFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, MediaFile{Name: path.Join(dir, entry.Name()), Modified: info.ModTime()})
+	}
+
+	return files, nil
+}
+
+func (m *MediaLocal) URL(name string) string {
+	return "/" + name
+}
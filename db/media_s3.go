@@ -0,0 +1,313 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MediaS3 stores media in a bucket of any S3-compatible service using
+// path-style requests signed with AWS Signature Version 4
+type MediaS3 struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	publicURL string
+
+	client *http.Client
+}
+
+func NewMediaS3(endpoint, region, bucket, accessKey, secretKey, publicURL string) (*MediaS3, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endpoint: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint \"%s\"", endpoint)
+	}
+
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &MediaS3{
+		endpoint:  u,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		client:    &http.Client{Timeout: time.Second * 30},
+	}, nil
+}
+
+func (m *MediaS3) do(method string, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *m.endpoint
+	u.Path = path.Join("/", u.Path, m.bucket, key)
+	u.RawPath = s3Escape(u.Path)
+	u.RawQuery = s3Query(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+	}
+
+	m.sign(req, body, time.Now())
+
+	return m.client.Do(req)
+}
+
+func (m *MediaS3) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, m.region)
+
+	payload := sha256.Sum256(body)
+
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+
+	// canonical headers
+	headers := []string{"host"}
+	for name := range req.Header {
+		headers = append(headers, strings.ToLower(name))
+	}
+
+	slices.Sort(headers)
+
+	var canonical strings.Builder
+	for _, name := range headers {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+
+		fmt.Fprintf(&canonical, "%s:%s\n", name, strings.TrimSpace(value))
+	}
+
+	signed := strings.Join(headers, ";")
+
+	request := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonical.String(),
+		signed,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(request))
+
+	key := []byte("AWS4" + m.secretKey)
+	for _, part := range []string{date, m.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	signature := hmacSHA256(key, strings.Join([]string{"AWS4-HMAC-SHA256", now.Format("20060102T150405Z"), scope, hex.EncodeToString(hash[:])}, "\n"))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", m.accessKey, scope, signed, hex.EncodeToString(signature)))
+}
+
+func (m *MediaS3) Put(name string, r io.Reader) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.do(http.MethodPut, name, nil, body)
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+
+	return nil
+}
+
+// Get reads the whole object into memory so it can be seeked, media is
+// limited to the upload size and boards with a public url never serve it
+func (m *MediaS3) Get(name string) (io.ReadSeekCloser, MediaFile, error) {
+	resp, err := m.do(http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, MediaFile{}, fmt.Errorf("failed to fetch object: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, MediaFile{}, ErrUnknownMedia
+	default:
+		return nil, MediaFile{}, s3Error(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, MediaFile{}, fmt.Errorf("failed to read object: %w", err)
+	}
+
+	file := MediaFile{Name: name}
+	file.Modified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	return nopCloser{bytes.NewReader(body)}, file, nil
+}
+
+func (m *MediaS3) Delete(name string) error {
+	resp, err := m.do(http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return ErrUnknownMedia
+	}
+
+	return s3Error(resp)
+}
+
+func (m *MediaS3) List(dir string) ([]MediaFile, error) {
+	var files []MediaFile
+
+	query := url.Values{"list-type": {"2"}, "prefix": {strings.TrimSuffix(dir, "/") + "/"}}
+	for {
+		resp, err := m.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, s3Error(resp)
+		}
+
+		var result struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode object list: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			files = append(files, MediaFile{Name: object.Key, Modified: object.LastModified})
+		}
+
+		if !result.IsTruncated {
+			break
+		}
+
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+
+	return files, nil
+}
+
+func (m *MediaS3) URL(name string) string {
+	if m.publicURL == "" {
+		return "/" + name
+	}
+
+	return m.publicURL + "/" + name
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func s3Error(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+// s3Escape encodes a path the way S3 expects in canonical requests
+func s3Escape(p string) string {
+	var b strings.Builder
+	for _, c := range []byte(p) {
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+			continue
+		}
+
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
+
+// s3Query encodes query parameters sorted by key, as canonical requests require
+func s3Query(query url.Values) string {
+	var parts []string
+	for key, values := range query {
+		for _, value := range values {
+			parts = append(parts, s3Escape(key)+"="+strings.ReplaceAll(s3Escape(value), "/", "%2F"))
+		}
+	}
+
+	slices.Sort(parts)
+
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
@@ -19,16 +19,17 @@
 package db
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"image"
 	"image/color"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
-	"os"
-	"path"
+	"slices"
 	"strings"
 	"time"
 
@@ -38,14 +39,24 @@ import (
 var ErrUnknownPost = errors.New("unknown post")
 
 type Post struct {
-	Parent  string    `json:"parent,omitempty"`
-	Name    string    `json:"name,omitempty"`
-	Subject string    `json:"subject,omitempty"`
-	Body    string    `json:"body,omitempty"`
-	Image   bool      `json:"image,omitempty"`
-	Poster  string    `json:"poster,omitempty"`
-	Posted  time.Time `json:"posted,omitzero"`
-	Replies []Post    `json:"replies,omitempty"`
+	Parent        string    `json:"parent,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	Subject       string    `json:"subject,omitempty"`
+	Body          string    `json:"body,omitempty"`
+	Image         bool      `json:"image,omitempty"`
+	Animated      bool      `json:"animated,omitempty"`
+	AnimatedThumb bool      `json:"animatedThumb,omitempty"`
+	Spoiler       bool      `json:"spoiler,omitempty"`
+	ImageAlt      string    `json:"imageAlt,omitempty"`
+	Poster        string    `json:"poster,omitempty"`
+	Staff         string    `json:"staff,omitempty"`
+	BanNotice     bool      `json:"banNotice,omitempty"` // show that the poster was banned for this post
+	Posted        time.Time `json:"posted,omitzero"`
+	Pending       bool      `json:"pending,omitempty"`     // held until approved by staff
+	Deleted       time.Time `json:"deleted,omitzero"`      // kept until purged after the retention period
+	ImageDeleted  time.Time `json:"imageDeleted,omitzero"` // image hidden, its files are kept until purged
+	Shadow        bool      `json:"shadow,omitempty"`      // made while shadow banned, only shown to its poster
+	Replies       []Post    `json:"replies,omitempty"`
 }
 
 func (p Post) ID() string {
@@ -63,73 +74,253 @@ func (p Post) IsThread() bool {
 	return p.Parent == ""
 }
 
-func (p Post) IsAdmin() bool {
-	return p.Poster == "admin"
+func (p Post) IsDeleted() bool {
+	return !p.Deleted.IsZero()
+}
+
+func (p Post) IsImageDeleted() bool {
+	return !p.ImageDeleted.IsZero()
+}
+
+// Bumped returns when the thread was last bumped, ignoring hidden replies and those past the bump limit
+func (p Post) Bumped(limit int) time.Time {
+	bumped := p.Posted
+
+	var bumps int
+	for _, reply := range p.Replies {
+		if bumps == limit {
+			break
+		}
+		if reply.IsDeleted() || reply.Pending || reply.Shadow {
+			continue
+		}
+
+		bumped = reply.Posted
+		bumps++
+	}
+
+	return bumped
+}
+
+// WithoutPosters returns a copy of the post with the poster ids of it and its replies removed,
+// for keeping its content around longer than who made it
+func (p Post) WithoutPosters() Post {
+	p.Poster = ""
+
+	if p.Replies != nil {
+		replies := make([]Post, len(p.Replies))
+		for i, reply := range p.Replies {
+			replies[i] = reply.WithoutPosters()
+		}
+
+		p.Replies = replies
+	}
+
+	return p
+}
+
+// hasPoster reports whether the post or any of its replies still has a poster id
+func (p Post) hasPoster() bool {
+	if p.Poster != "" {
+		return true
+	}
+
+	return slices.ContainsFunc(p.Replies, Post.hasPoster)
+}
+
+func (p Post) IsStaff() bool {
+	return p.Staff != "" || p.Poster == "admin" // posts from before staff accounts
 }
 
 func (p Post) ThumbPath() string {
+	if p.AnimatedThumb {
+		return fmt.Sprintf("thumb/%s.gif", p.ID())
+	}
+
 	return fmt.Sprintf("thumb/%s.jpg", p.ID())
 }
 
 func (p Post) FullPath() string {
+	if p.Animated {
+		return fmt.Sprintf("full/%s.gif", p.ID())
+	}
+
 	return fmt.Sprintf("full/%s.png", p.ID())
 }
 
-func (p Post) DeleteImage() error {
-	err := os.Remove(path.Join("data", p.FullPath()))
-	if err != nil {
+func (p Post) DeleteImage(media MediaStore) error {
+	err := media.Delete(p.FullPath())
+	if err != nil && err != ErrUnknownMedia {
 		return fmt.Errorf("failed to delete full image: %w", err)
 	}
 
-	err = os.Remove(path.Join("data", p.ThumbPath()))
-	if err != nil {
+	err = media.Delete(p.ThumbPath())
+	if err != nil && err != ErrUnknownMedia {
 		return fmt.Errorf("failed to delete thumbnail image: %w", err)
 	}
 
 	return nil
 }
 
-func (p Post) WriteImage(img image.Image) error {
+// RemoveImage deletes the post's image and clears every image field
+func (p *Post) RemoveImage(media MediaStore) error {
+	err := p.DeleteImage(media)
+	if err != nil {
+		return err
+	}
+
+	p.Image = false
+	p.Animated = false
+	p.AnimatedThumb = false
+	p.Spoiler = false
+	p.ImageAlt = ""
+	p.ImageDeleted = time.Time{}
+
+	return nil
+}
+
+const (
+	maxDimensionSize = 150
+	thumbnailQuality = 80
+
+	maxThumbnailFrames = 100
+	maxThumbnailBytes  = 512 * 1024
+)
+
+func (p Post) WriteImage(media MediaStore, img image.Image) error {
 	// full image
-	of, err := os.OpenFile(path.Join("data", p.FullPath()), os.O_CREATE|os.O_WRONLY, 0644)
+	err := writeMedia(media, p.FullPath(), func(b *bytes.Buffer) error {
+		return png.Encode(b, img)
+	})
 	if err != nil {
 		return err
 	}
 
-	defer of.Close()
+	// thumbnail image
+	err = writeMedia(media, p.ThumbPath(), func(b *bytes.Buffer) error {
+		return jpeg.Encode(b, thumbnail(img), &jpeg.Options{Quality: thumbnailQuality})
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WriteAnimation stores the uploaded gif as is for the full image and, if it
+// fits within the frame and byte budget, an animated thumbnail made from its
+// decoded frames g. Otherwise the thumbnail is a still of the first frame.
+func (p *Post) WriteAnimation(media MediaStore, data []byte, g *gif.GIF) error {
+	p.Animated = true
+	p.AnimatedThumb = false
 
-	err = png.Encode(of, img)
+	// full image
+	err := media.Put(p.FullPath(), bytes.NewReader(data))
 	if err != nil {
 		return err
 	}
 
 	// thumbnail image
-	const maxDimensionSize = 150
-	const thumbnailQuality = 80
+	var thumb bytes.Buffer
+	var still image.Image
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+	}
+
+	tg := &gif.GIF{LoopCount: g.LoopCount}
+
+	canvas := image.NewRGBA(bounds)
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(frame.Bounds())
+			draw.Draw(previous, previous.Bounds(), canvas, frame.Bounds().Min, draw.Src)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		if still == nil {
+			still = thumbnail(canvas)
+			if len(g.Image) > maxThumbnailFrames {
+				break
+			}
+		}
+
+		// map the scaled frame back onto its own palette, plus white for the background
+		pal := append(color.Palette{}, frame.Palette...)
+		if len(pal) < 256 {
+			pal = append(pal, color.White)
+		}
+
+		tf := thumbnail(canvas)
+		pf := image.NewPaletted(tf.Bounds(), pal)
+		draw.Draw(pf, pf.Bounds(), tf, image.Point{}, draw.Src)
+
+		tg.Image = append(tg.Image, pf)
+		tg.Delay = append(tg.Delay, g.Delay[i])
 
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			draw.Draw(canvas, frame.Bounds(), previous, previous.Bounds().Min, draw.Src)
+		}
+	}
+
+	if len(tg.Image) == len(g.Image) {
+		err = gif.EncodeAll(&thumb, tg)
+		if err != nil {
+			return err
+		}
+
+		p.AnimatedThumb = thumb.Len() <= maxThumbnailBytes
+	}
+
+	err = writeMedia(media, p.ThumbPath(), func(b *bytes.Buffer) error {
+		if p.AnimatedThumb {
+			_, err := thumb.WriteTo(b)
+			return err
+		}
+
+		return jpeg.Encode(b, still, &jpeg.Options{Quality: thumbnailQuality})
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func thumbnail(img image.Image) *image.RGBA {
 	scale := maxDimensionSize / float64(img.Bounds().Dx()) // assume landscape
 	if img.Bounds().Dy() >= img.Bounds().Dx() {            // it's not
 		scale = maxDimensionSize / float64(img.Bounds().Dy())
 	}
 
-	oimg := image.NewRGBA(image.Rect(0, 0, int(scale*float64(img.Bounds().Dx())), int(scale*float64(img.Bounds().Dy()))))
+	oimg := image.NewRGBA(image.Rect(0, 0, max(1, int(scale*float64(img.Bounds().Dx()))), max(1, int(scale*float64(img.Bounds().Dy())))))
 
 	draw.Draw(oimg, oimg.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
 	draw.BiLinear.Scale(oimg, oimg.Bounds(), img, img.Bounds(), draw.Over, nil)
 
-	of, err = os.OpenFile(path.Join("data", p.ThumbPath()), os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
+	return oimg
+}
 
-	defer of.Close()
+func writeMedia(media MediaStore, name string, encode func(b *bytes.Buffer) error) error {
+	var b bytes.Buffer
 
-	err = jpeg.Encode(of, oimg, &jpeg.Options{Quality: thumbnailQuality})
+	err := encode(&b)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return media.Put(name, &b)
 }
 
 type PostData []Post
@@ -138,6 +329,11 @@ type PostDB interface {
 	GetAll() (PostData, error)
 	Get(id string) (Post, error)
 	Add(post Post) (string, error)
+	Update(post Post) error
 	Delete(id string) error
 	DeletePoster(id string) error
+	DeletePosterImages(id string) error
+	Undelete(id string) error
+	Purge(before time.Time) ([]string, error)
+	ForgetPosters(before time.Time) (int, error) // clears the poster id of posts made before
 }
@@ -24,17 +24,19 @@ import (
 	"os"
 	"slices"
 	"sync"
+	"time"
 
 	. "github.com/patapancakes/tanuki/config"
 )
 
 type PostJSON struct {
-	file string
-	mtx  sync.RWMutex
+	file  string
+	media MediaStore
+	mtx   sync.RWMutex
 }
 
-func NewPostJSON(file string) *PostJSON {
-	return &PostJSON{file: file}
+func NewPostJSON(file string, media MediaStore) *PostJSON {
+	return &PostJSON{file: file, media: media}
 }
 
 func (p *PostJSON) read() (PostData, error) {
@@ -85,19 +87,13 @@ func (p *PostJSON) GetAll() (PostData, error) {
 
 	// sort threads by newest reply
 	slices.SortFunc(posts, func(a, b Post) int {
-		t1 := a.Posted
-		if len(a.Replies) != 0 {
-			t1 = a.Replies[min(Config.MaxBumps, len(a.Replies))-1].Posted
-		}
-		t2 := b.Posted
-		if len(b.Replies) != 0 {
-			t2 = b.Replies[min(Config.MaxBumps, len(b.Replies))-1].Posted
-		}
+		t1 := a.Bumped(Config.MaxBumps)
+		t2 := b.Bumped(Config.MaxBumps)
 
-		if a.IsAdmin() && !b.IsAdmin() {
+		if a.IsStaff() && !b.IsStaff() {
 			return -1
 		}
-		if b.IsAdmin() && !a.IsAdmin() {
+		if b.IsStaff() && !a.IsStaff() {
 			return 1
 		}
 
@@ -145,7 +141,7 @@ func (p *PostJSON) Add(post Post) (string, error) {
 	} else { // new reply
 		var found bool
 		for i, p := range posts {
-			if p.ID() != post.Parent {
+			if p.ID() != post.Parent || p.IsDeleted() {
 				continue
 			}
 
@@ -167,7 +163,54 @@ func (p *PostJSON) Add(post Post) (string, error) {
 	return post.ID(), nil
 }
 
-func (p *PostJSON) delete(id string) error {
+// Update replaces a stored post with the same id, keeping a thread's replies
+func (p *PostJSON) Update(post Post) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	posts, err := p.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch posts: %w", err)
+	}
+
+	var found bool
+	for i, thread := range posts {
+		if thread.ID() == post.ID() {
+			found = true
+
+			post.Replies = thread.Replies
+			posts[i] = post
+			break
+		}
+
+		for j, reply := range thread.Replies {
+			if reply.ID() != post.ID() {
+				continue
+			}
+
+			found = true
+
+			posts[i].Replies[j] = post
+			break
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		return ErrUnknownPost
+	}
+
+	err = p.write(posts)
+	if err != nil {
+		return fmt.Errorf("failed to write posts: %w", err)
+	}
+
+	return nil
+}
+
+// purge removes a post for good along with its replies and images
+func (p *PostJSON) purge(id string) error {
 	posts, err := p.read()
 	if err != nil {
 		return fmt.Errorf("failed to fetch posts: %w", err)
@@ -195,7 +238,7 @@ func (p *PostJSON) delete(id string) error {
 				continue
 			}
 
-			err = reply.DeleteImage()
+			err = reply.DeleteImage(p.media)
 			if err != nil {
 				return fmt.Errorf("failed to delete reply images: %w", err)
 			}
@@ -210,7 +253,7 @@ func (p *PostJSON) delete(id string) error {
 		return ErrUnknownPost
 	}
 	if post.Image {
-		err = post.DeleteImage()
+		err = post.DeleteImage(p.media)
 		if err != nil {
 			return fmt.Errorf("failed to delete post images: %w", err)
 		}
@@ -224,14 +267,53 @@ func (p *PostJSON) delete(id string) error {
 	return nil
 }
 
+// mark sets the deletion time of every post matching f
+func (p *PostJSON) mark(f func(post Post) bool, deleted time.Time) (int, error) {
+	posts, err := p.read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch posts: %w", err)
+	}
+
+	var marked int
+	for i, thread := range posts {
+		if f(thread) {
+			posts[i].Deleted = deleted
+			marked++
+		}
+
+		for j, reply := range thread.Replies {
+			if !f(reply) {
+				continue
+			}
+
+			posts[i].Replies[j].Deleted = deleted
+			marked++
+		}
+	}
+	if marked == 0 {
+		return 0, nil
+	}
+
+	err = p.write(posts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write posts: %w", err)
+	}
+
+	return marked, nil
+}
+
+// Delete hides a post, its content and images are kept until it's purged
 func (p *PostJSON) Delete(id string) error {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 
-	err := p.delete(id)
+	marked, err := p.mark(func(post Post) bool { return post.ID() == id && !post.IsDeleted() }, time.Now())
 	if err != nil {
 		return err
 	}
+	if marked == 0 {
+		return ErrUnknownPost
+	}
 
 	return nil
 }
@@ -240,32 +322,210 @@ func (p *PostJSON) DeletePoster(id string) error {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 
+	_, err := p.mark(func(post Post) bool { return post.Poster == id && !post.IsDeleted() }, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PostJSON) Undelete(id string) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
 	posts, err := p.read()
 	if err != nil {
 		return fmt.Errorf("failed to fetch posts: %w", err)
 	}
 
-	for _, thread := range posts {
-		if thread.Poster == id {
-			err = p.delete(thread.ID())
-			if err != nil {
-				return fmt.Errorf("failed to delete post: %w", err)
+	undelete := func(post *Post) bool {
+		if post.ID() != id || (!post.IsDeleted() && !post.IsImageDeleted()) {
+			return false
+		}
+
+		post.Deleted = time.Time{}
+		post.ImageDeleted = time.Time{}
+
+		return true
+	}
+
+	var found bool
+	for i := range posts {
+		if undelete(&posts[i]) {
+			found = true
+		}
+
+		for j := range posts[i].Replies {
+			if undelete(&posts[i].Replies[j]) {
+				found = true
 			}
+		}
+	}
+	if !found {
+		return ErrUnknownPost
+	}
 
-			continue
+	err = p.write(posts)
+	if err != nil {
+		return fmt.Errorf("failed to write posts: %w", err)
+	}
+
+	return nil
+}
+
+// Purge permanently removes posts deleted before the given time and returns their ids
+func (p *PostJSON) Purge(before time.Time) ([]string, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	posts, err := p.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch posts: %w", err)
+	}
+
+	var ids []string
+	for _, thread := range posts {
+		if thread.IsDeleted() && thread.Deleted.Before(before) {
+			ids = append(ids, thread.ID())
+			continue // replies go with the thread
 		}
 
 		for _, reply := range thread.Replies {
-			if reply.Poster != id {
-				continue
+			if reply.IsDeleted() && reply.Deleted.Before(before) {
+				ids = append(ids, reply.ID())
 			}
+		}
+	}
+
+	for _, id := range ids {
+		err = p.purge(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to purge post: %w", err)
+		}
+	}
+
+	err = p.purgeImages(before)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
 
-			err = p.delete(reply.ID())
+// purgeImages permanently removes images deleted before the given time
+func (p *PostJSON) purgeImages(before time.Time) error {
+	posts, err := p.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch posts: %w", err)
+	}
+
+	var purged bool
+	remove := func(post *Post) error {
+		if !post.IsImageDeleted() || !post.ImageDeleted.Before(before) {
+			return nil
+		}
+
+		purged = true
+
+		return post.RemoveImage(p.media)
+	}
+
+	for i := range posts {
+		err = remove(&posts[i])
+		if err != nil {
+			return fmt.Errorf("failed to purge post image: %w", err)
+		}
+
+		for j := range posts[i].Replies {
+			err = remove(&posts[i].Replies[j])
 			if err != nil {
-				return fmt.Errorf("failed to delete post: %w", err)
+				return fmt.Errorf("failed to purge post image: %w", err)
+			}
+		}
+	}
+	if !purged {
+		return nil
+	}
+
+	err = p.write(posts)
+	if err != nil {
+		return fmt.Errorf("failed to write posts: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePosterImages hides the images from every post by a poster, leaving the posts themselves,
+// the files are kept until purged after the retention period
+func (p *PostJSON) DeletePosterImages(id string) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	posts, err := p.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch posts: %w", err)
+	}
+
+	now := time.Now()
+	for i, thread := range posts {
+		if thread.Poster == id && thread.Image && !thread.IsImageDeleted() {
+			posts[i].ImageDeleted = now
+		}
+
+		for j, reply := range thread.Replies {
+			if reply.Poster == id && reply.Image && !reply.IsImageDeleted() {
+				posts[i].Replies[j].ImageDeleted = now
 			}
 		}
 	}
 
+	err = p.write(posts)
+	if err != nil {
+		return fmt.Errorf("failed to write posts: %w", err)
+	}
+
 	return nil
 }
+
+func (p *PostJSON) ForgetPosters(before time.Time) (int, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	posts, err := p.read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch posts: %w", err)
+	}
+
+	// legacy "admin" posts are staff posts, not a poster id
+	forget := func(post Post) bool {
+		return post.Poster != "" && !post.IsStaff() && post.Posted.Before(before)
+	}
+
+	var forgotten int
+	for i, thread := range posts {
+		if forget(thread) {
+			posts[i].Poster = ""
+			forgotten++
+		}
+
+		for j, reply := range thread.Replies {
+			if !forget(reply) {
+				continue
+			}
+
+			posts[i].Replies[j].Poster = ""
+			forgotten++
+		}
+	}
+	if forgotten == 0 {
+		return 0, nil
+	}
+
+	err = p.write(posts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write posts: %w", err)
+	}
+
+	return forgotten, nil
+}
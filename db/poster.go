@@ -26,14 +26,55 @@ import (
 var ErrUnknownPoster = errors.New("unknown poster")
 
 type Poster struct {
-	LastPost  time.Time `json:"lastPost,omitzero"`
-	LastLogin time.Time `json:"lastLogin,omitzero"`
-	BanTime   time.Time `json:"banTime,omitzero"`
-	BanReason string    `json:"banReason,omitempty"`
+	LastPost   time.Time `json:"lastPost,omitzero"`
+	LastLogin  time.Time `json:"lastLogin,omitzero"`
+	LastReport time.Time `json:"lastReport,omitzero"`
+	Held       bool      `json:"held,omitempty"` // every post so far has been held for approval
+	BanTime    time.Time `json:"banTime,omitzero"`
+	BanReason  string    `json:"banReason,omitempty"`
+	BanExpiry  time.Time `json:"banExpiry,omitzero"`  // zero for permanent bans
+	BanPost    *Post     `json:"banPost,omitempty"`   // post the ban was issued for
+	BanShadow  bool      `json:"banShadow,omitempty"` // posts are accepted but only shown to the poster
+}
+
+// banActive reports whether there is an unexpired ban of either kind
+func (p Poster) banActive() bool {
+	return !p.BanTime.IsZero() && (p.BanExpiry.IsZero() || p.BanExpiry.After(time.Now()))
+}
+
+// IsApproved reports whether the poster has had a post go live, posters from before
+// moderation existed have posted without being held so they count as approved
+func (p Poster) IsApproved() bool {
+	return !p.LastPost.IsZero() && !p.Held
 }
 
 func (p Poster) IsBanned() bool {
-	return !p.BanTime.IsZero()
+	return p.banActive() && !p.BanShadow
+}
+
+func (p Poster) IsShadowBanned() bool {
+	return p.banActive() && p.BanShadow
+}
+
+// lastSeen returns the last time the poster did anything
+func (p Poster) lastSeen() time.Time {
+	seen := p.LastPost
+	for _, t := range []time.Time{p.LastLogin, p.LastReport, p.BanTime} {
+		if t.After(seen) {
+			seen = t
+		}
+	}
+
+	return seen
+}
+
+// Unban clears every ban field
+func (p *Poster) Unban() {
+	p.BanTime = time.Time{}
+	p.BanReason = ""
+	p.BanExpiry = time.Time{}
+	p.BanPost = nil
+	p.BanShadow = false
 }
 
 type PosterData map[string]Poster
@@ -41,5 +82,8 @@ type PosterData map[string]Poster
 type PosterDB interface {
 	Get(id string) (Poster, error)
 	GetBanned() (PosterData, error)
+	CountActive(since time.Time) (int, error)
 	Add(id string, poster Poster) error
+	ExpireBans() ([]string, error)
+	Prune(before time.Time) ([]string, error) // removes posters inactive since before, unless banned, and poster ids from ban posts
 }
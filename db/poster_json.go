@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 )
 
 type PosterJSON struct {
@@ -99,7 +100,7 @@ func (p *PosterJSON) GetBanned() (PosterData, error) {
 
 	banned := make(PosterData)
 	for id, p := range posters {
-		if !p.IsBanned() {
+		if !p.banActive() {
 			continue
 		}
 
@@ -109,6 +110,26 @@ func (p *PosterJSON) GetBanned() (PosterData, error) {
 	return banned, nil
 }
 
+// CountActive returns how many posters have posted since the given time
+func (p *PosterJSON) CountActive(since time.Time) (int, error) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	posters, err := p.read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch posters: %w", err)
+	}
+
+	var active int
+	for _, poster := range posters {
+		if poster.LastPost.After(since) {
+			active++
+		}
+	}
+
+	return active, nil
+}
+
 func (p *PosterJSON) Add(id string, poster Poster) error {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
@@ -127,3 +148,77 @@ func (p *PosterJSON) Add(id string, poster Poster) error {
 
 	return nil
 }
+
+// ExpireBans lifts every ban that has run out and returns the affected ids
+func (p *PosterJSON) ExpireBans() ([]string, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	posters, err := p.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch posters: %w", err)
+	}
+
+	var expired []string
+	for id, poster := range posters {
+		if poster.BanTime.IsZero() || poster.banActive() {
+			continue
+		}
+
+		poster.Unban()
+
+		posters[id] = poster
+
+		expired = append(expired, id)
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	err = p.write(posters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update posters: %w", err)
+	}
+
+	return expired, nil
+}
+
+func (p *PosterJSON) Prune(before time.Time) ([]string, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	posters, err := p.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch posters: %w", err)
+	}
+
+	var pruned []string
+	var stripped bool
+	for id, poster := range posters {
+		// posts banned for were once stored along with their poster ids
+		if poster.BanPost != nil && poster.BanPost.hasPoster() {
+			banPost := poster.BanPost.WithoutPosters()
+			poster.BanPost = &banPost
+			posters[id] = poster
+			stripped = true
+		}
+
+		if poster.banActive() || poster.lastSeen().After(before) {
+			continue
+		}
+
+		delete(posters, id)
+
+		pruned = append(pruned, id)
+	}
+	if len(pruned) == 0 && !stripped {
+		return nil, nil
+	}
+
+	err = p.write(posters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update posters: %w", err)
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,48 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+)
+
+var ErrUnknownRange = errors.New("unknown range")
+
+type RangeBan struct {
+	BanTime   time.Time `json:"banTime"`
+	BanReason string    `json:"banReason,omitempty"`
+	BanExpiry time.Time `json:"banExpiry,omitzero"` // zero for permanent bans
+}
+
+func (b RangeBan) IsActive() bool {
+	return b.BanExpiry.IsZero() || b.BanExpiry.After(time.Now())
+}
+
+// RangeBanData maps address prefixes in CIDR notation to their bans
+type RangeBanData map[string]RangeBan
+
+type RangeBanDB interface {
+	GetAll() (RangeBanData, error)
+	Match(addr netip.Addr) (string, RangeBan, error)
+	Add(prefix netip.Prefix, ban RangeBan) error
+	Delete(prefix string) error
+	ExpireBans() ([]string, error)
+}
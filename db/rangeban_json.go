@@ -0,0 +1,198 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+)
+
+type RangeBanJSON struct {
+	file string
+	mtx  sync.RWMutex
+}
+
+func NewRangeBanJSON(file string) *RangeBanJSON {
+	return &RangeBanJSON{file: file}
+}
+
+func (b *RangeBanJSON) read() (RangeBanData, error) {
+	f, err := os.Open(b.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(RangeBanData), nil
+		}
+
+		return nil, fmt.Errorf("failed to open range bans file: %w", err)
+	}
+
+	defer f.Close()
+
+	bans := make(RangeBanData)
+	err = json.NewDecoder(f).Decode(&bans)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode range bans file: %w", err)
+	}
+
+	return bans, nil
+}
+
+func (b *RangeBanJSON) write(bans RangeBanData) error {
+	f, err := os.OpenFile(b.file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open range bans file: %w", err)
+	}
+
+	defer f.Close()
+
+	err = json.NewEncoder(f).Encode(bans)
+	if err != nil {
+		return fmt.Errorf("failed to encode range bans file: %w", err)
+	}
+
+	return nil
+}
+
+func (b *RangeBanJSON) GetAll() (RangeBanData, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	bans, err := b.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch range bans: %w", err)
+	}
+
+	active := make(RangeBanData)
+	for prefix, ban := range bans {
+		if !ban.IsActive() {
+			continue
+		}
+
+		active[prefix] = ban
+	}
+
+	return active, nil
+}
+
+// Match finds an active ban on a range containing addr
+func (b *RangeBanJSON) Match(addr netip.Addr) (string, RangeBan, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	bans, err := b.read()
+	if err != nil {
+		return "", RangeBan{}, fmt.Errorf("failed to fetch range bans: %w", err)
+	}
+
+	addr = addr.Unmap()
+	for prefix, ban := range bans {
+		if !ban.IsActive() {
+			continue
+		}
+
+		p, err := netip.ParsePrefix(prefix)
+		if err != nil {
+			continue
+		}
+
+		if p.Contains(addr) {
+			return prefix, ban, nil
+		}
+	}
+
+	return "", RangeBan{}, ErrUnknownRange
+}
+
+func (b *RangeBanJSON) Add(prefix netip.Prefix, ban RangeBan) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	bans, err := b.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch range bans: %w", err)
+	}
+
+	bans[prefix.Masked().String()] = ban
+
+	err = b.write(bans)
+	if err != nil {
+		return fmt.Errorf("failed to insert range ban: %w", err)
+	}
+
+	return nil
+}
+
+func (b *RangeBanJSON) Delete(prefix string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	bans, err := b.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch range bans: %w", err)
+	}
+
+	_, ok := bans[prefix]
+	if !ok {
+		return ErrUnknownRange
+	}
+
+	delete(bans, prefix)
+
+	err = b.write(bans)
+	if err != nil {
+		return fmt.Errorf("failed to delete range ban: %w", err)
+	}
+
+	return nil
+}
+
+// ExpireBans removes every range ban that has run out and returns the affected ranges
+func (b *RangeBanJSON) ExpireBans() ([]string, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	bans, err := b.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch range bans: %w", err)
+	}
+
+	var expired []string
+	for prefix, ban := range bans {
+		if ban.IsActive() {
+			continue
+		}
+
+		delete(bans, prefix)
+
+		expired = append(expired, prefix)
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	err = b.write(bans)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update range bans: %w", err)
+	}
+
+	return expired, nil
+}
@@ -0,0 +1,41 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"time"
+)
+
+type Report struct {
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// PostReports maps reporter ids to their report, so each poster counts once
+type PostReports map[string]Report
+
+// ReportData maps post ids to their reports
+type ReportData map[string]PostReports
+
+type ReportDB interface {
+	GetAll() (ReportData, error)
+	Add(post string, reporter string, report Report) error
+	Delete(post string) error
+	Forget(before time.Time) (int, error)
+}
@@ -0,0 +1,164 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type ReportJSON struct {
+	file string
+	mtx  sync.RWMutex
+}
+
+func NewReportJSON(file string) *ReportJSON {
+	return &ReportJSON{file: file}
+}
+
+func (r *ReportJSON) read() (ReportData, error) {
+	f, err := os.Open(r.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(ReportData), nil
+		}
+
+		return nil, fmt.Errorf("failed to open reports file: %w", err)
+	}
+
+	defer f.Close()
+
+	reports := make(ReportData)
+	err = json.NewDecoder(f).Decode(&reports)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode reports file: %w", err)
+	}
+
+	return reports, nil
+}
+
+func (r *ReportJSON) write(reports ReportData) error {
+	f, err := os.OpenFile(r.file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open reports file: %w", err)
+	}
+
+	defer f.Close()
+
+	err = json.NewEncoder(f).Encode(reports)
+	if err != nil {
+		return fmt.Errorf("failed to encode reports file: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ReportJSON) GetAll() (ReportData, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	reports, err := r.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reports: %w", err)
+	}
+
+	return reports, nil
+}
+
+// Add files a report against a post, replacing any earlier report from the same reporter
+func (r *ReportJSON) Add(post string, reporter string, report Report) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	reports, err := r.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch reports: %w", err)
+	}
+
+	if reports[post] == nil {
+		reports[post] = make(PostReports)
+	}
+
+	reports[post][reporter] = report
+
+	err = r.write(reports)
+	if err != nil {
+		return fmt.Errorf("failed to insert report: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ReportJSON) Delete(post string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	reports, err := r.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch reports: %w", err)
+	}
+
+	delete(reports, post)
+
+	err = r.write(reports)
+	if err != nil {
+		return fmt.Errorf("failed to delete reports: %w", err)
+	}
+
+	return nil
+}
+
+// Forget removes reports filed before the given time, as they're keyed by who filed them,
+// returning how many were removed
+func (r *ReportJSON) Forget(before time.Time) (int, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	reports, err := r.read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch reports: %w", err)
+	}
+
+	var forgotten int
+	for post, postReports := range reports {
+		for reporter, report := range postReports {
+			if report.Time.Before(before) {
+				delete(postReports, reporter)
+				forgotten++
+			}
+		}
+
+		if len(postReports) == 0 {
+			delete(reports, post)
+		}
+	}
+	if forgotten == 0 {
+		return 0, nil
+	}
+
+	err = r.write(reports)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete reports: %w", err)
+	}
+
+	return forgotten, nil
+}
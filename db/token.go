@@ -0,0 +1,84 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"time"
+)
+
+var ErrUnknownToken = errors.New("unknown token")
+
+type Scope string
+
+const (
+	ScopeThreads Scope = "threads" // start new threads
+	ScopeReplies Scope = "replies" // reply to threads
+	ScopeTrusted Scope = "trusted" // skip captchas, proof of work and blocklists
+)
+
+var Scopes = []Scope{ScopeThreads, ScopeReplies, ScopeTrusted}
+
+func (s Scope) IsValid() bool {
+	return slices.Contains(Scopes, s)
+}
+
+// Token is an api token issued by staff, only a hash of its secret is stored
+type Token struct {
+	Name      string    `json:"name"`
+	Scopes    []Scope   `json:"scopes"`
+	RateLimit int       `json:"rateLimit,omitempty"` // posts per hour, zero for no limit
+	Creator   string    `json:"creator"`
+	Created   time.Time `json:"created"`
+}
+
+// NewToken generates a secret for a token, returning it along with the hash the token is stored under
+func NewToken() (string, string) {
+	var b [32]byte
+	rand.Read(b[:])
+
+	secret := "tnk_" + base64.RawURLEncoding.EncodeToString(b[:])
+
+	return secret, HashToken(secret)
+}
+
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func (t Token) HasScope(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// TokenData maps token hashes to their tokens
+type TokenData map[string]Token
+
+type TokenDB interface {
+	Get(hash string) (Token, error)
+	GetAll() (TokenData, error)
+	Add(hash string, token Token) error
+	Delete(hash string) error
+}
@@ -0,0 +1,144 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+type TokenJSON struct {
+	file string
+	mtx  sync.RWMutex
+}
+
+func NewTokenJSON(file string) *TokenJSON {
+	return &TokenJSON{file: file}
+}
+
+func (t *TokenJSON) read() (TokenData, error) {
+	f, err := os.Open(t.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(TokenData), nil
+		}
+
+		return nil, fmt.Errorf("failed to open tokens file: %w", err)
+	}
+
+	defer f.Close()
+
+	tokens := make(TokenData)
+	err = json.NewDecoder(f).Decode(&tokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode tokens file: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (t *TokenJSON) write(tokens TokenData) error {
+	f, err := os.OpenFile(t.file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open tokens file: %w", err)
+	}
+
+	defer f.Close()
+
+	err = json.NewEncoder(f).Encode(tokens)
+	if err != nil {
+		return fmt.Errorf("failed to encode tokens file: %w", err)
+	}
+
+	return nil
+}
+
+func (t *TokenJSON) Get(hash string) (Token, error) {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	tokens, err := t.read()
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to fetch tokens: %w", err)
+	}
+
+	token, ok := tokens[hash]
+	if !ok {
+		return Token{}, ErrUnknownToken
+	}
+
+	return token, nil
+}
+
+func (t *TokenJSON) GetAll() (TokenData, error) {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	tokens, err := t.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (t *TokenJSON) Add(hash string, token Token) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	tokens, err := t.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch tokens: %w", err)
+	}
+
+	tokens[hash] = token
+
+	err = t.write(tokens)
+	if err != nil {
+		return fmt.Errorf("failed to insert token: %w", err)
+	}
+
+	return nil
+}
+
+func (t *TokenJSON) Delete(hash string) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	tokens, err := t.read()
+	if err != nil {
+		return fmt.Errorf("failed to fetch tokens: %w", err)
+	}
+
+	_, ok := tokens[hash]
+	if !ok {
+		return ErrUnknownToken
+	}
+
+	delete(tokens, hash)
+
+	err = t.write(tokens)
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+
+	return nil
+}
@@ -7,6 +7,14 @@ require github.com/xeonx/timeago v1.0.0-rc5
 require golang.org/x/image v0.35.0
 
 require (
+	github.com/gen2brain/avif v0.4.4
 	github.com/golang-jwt/jwt/v5 v5.3.1
+	golang.org/x/crypto v0.52.0
+	golang.org/x/text v0.37.0
 	gopkg.in/yaml.v3 v3.0.1
 )
+
+require (
+	github.com/ebitengine/purego v0.8.3 // indirect
+	github.com/tetratelabs/wazero v1.9.0 // indirect
+)
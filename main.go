@@ -19,17 +19,20 @@
 package main
 
 import (
+	"bufio"
 	"crypto/rand"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
 	. "github.com/patapancakes/tanuki/config"
+	"github.com/patapancakes/tanuki/db"
 	"github.com/patapancakes/tanuki/pages"
 )
 
@@ -45,32 +48,129 @@ func main() {
 		log.Fatalf("failed to parse config file: %s", err)
 	}
 
+	// create directories
+	os.MkdirAll("data", 0755)
+
 	// templates
 	err = pages.Init()
 	if err != nil {
-		log.Fatalf("failed to create page templates: %s", err)
+		log.Fatalf("failed to initialize pages: %s", err)
 	}
 
-	// create directories
-	os.MkdirAll("data/thumb", 0755)
-	os.MkdirAll("data/full", 0755)
-
 	// session keys
 	err = checkKey()
 	if err != nil {
 		log.Fatalf("failed to create session keys: %s", err)
 	}
 
+	// commands
+	switch flag.Arg(0) {
+	case "":
+	case "account":
+		if flag.NArg() != 3 {
+			log.Fatalf("usage: %s account <name> <role>", os.Args[0])
+		}
+
+		fmt.Fprintf(os.Stderr, "password: ")
+
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			log.Fatalf("failed to read password: %s", err)
+		}
+
+		err = pages.AddAccount(flag.Arg(1), db.Role(flag.Arg(2)), strings.TrimRight(password, "\r\n"))
+		if err != nil {
+			log.Fatalf("failed to add account: %s", err)
+		}
+
+		log.Printf("added account \"%s\"", flag.Arg(1))
+
+		return
+	case "rotate-key":
+		if Config.IdentityMode != "hmac" {
+			log.Fatalf("identity keys are only used with the \"hmac\" identity mode")
+		}
+
+		err = pages.RotateIdentityKey()
+		if err != nil {
+			log.Fatalf("failed to rotate identity key: %s", err)
+		}
+
+		log.Printf("rotated identity key")
+
+		return
+	case "gc":
+		err = pages.CollectGarbage()
+		if err != nil {
+			log.Fatalf("failed to collect media: %s", err)
+		}
+
+		return
+	default:
+		log.Fatalf("unknown command \"%s\"", flag.Arg(0))
+	}
+
+	// maintenance
+	go every(time.Minute, func() {
+		err := pages.ExpireBans()
+		if err != nil {
+			log.Printf("failed to expire bans: %s", err)
+		}
+	})
+
+	go every(time.Hour, func() {
+		err := pages.PurgeDeleted()
+		if err != nil {
+			log.Printf("failed to purge deleted posts: %s", err)
+		}
+	})
+
+	if Config.PosterRetention > 0 {
+		go every(time.Hour, func() {
+			err := pages.PurgePosterData()
+			if err != nil {
+				log.Printf("failed to purge poster data: %s", err)
+			}
+		})
+	}
+
+	if Config.GCInterval > 0 {
+		go every(time.Minute*time.Duration(Config.GCInterval), func() {
+			err := pages.CollectGarbage()
+			if err != nil {
+				log.Printf("failed to collect media: %s", err)
+			}
+		})
+	}
+
+	if Config.TorExitList != "" && Config.TorExitURL != "" {
+		refresh := func() {
+			err := pages.RefreshTorExits()
+			if err != nil {
+				log.Printf("failed to refresh tor exit list: %s", err)
+			}
+		}
+
+		go func() {
+			refresh()
+			every(time.Minute*time.Duration(Config.TorExitRefresh), refresh)
+		}()
+	}
+
 	// files
 	http.Handle("GET /assets/", cache(http.StripPrefix("/assets/", http.FileServerFS(pages.AssetsFS))))
-	http.Handle("GET /thumb/", cache(http.StripPrefix("/thumb/", http.FileServer(http.Dir("data/thumb")))))
-	http.Handle("GET /full/", cache(http.StripPrefix("/full/", http.FileServer(http.Dir("data/full")))))
+	http.HandleFunc("GET /thumb/", pages.Media)
+	http.HandleFunc("GET /full/", pages.Media)
 
 	http.HandleFunc("GET /", pages.Home)
 	http.HandleFunc("GET /{page}", pages.Home)
 
 	http.HandleFunc("GET /thread/{id}", pages.Thread)
 
+	http.HandleFunc("GET /feed.atom", pages.AtomFeed)
+	http.HandleFunc("GET /feed.rss", pages.RSSFeed)
+	http.HandleFunc("GET /thread/{id}/feed.atom", pages.ThreadFeed)
+
 	http.HandleFunc("GET /admin/bans", pages.Bans)
 	http.HandleFunc("GET /admin/confirm/{action}/{id}", pages.Confirm)
 
@@ -79,15 +179,70 @@ func main() {
 	http.HandleFunc("GET /admin/logout", pages.AdminLogout)
 
 	http.HandleFunc("POST /admin/delete", pages.AdminDelete)
+	http.HandleFunc("POST /admin/undelete", pages.AdminUndelete)
 	http.HandleFunc("POST /admin/ban", pages.AdminBan)
 
 	http.HandleFunc("POST /admin/unbanid", pages.AdminUnbanID)
+	http.HandleFunc("POST /admin/convertban", pages.AdminConvertBan)
+	http.HandleFunc("POST /admin/banrange", pages.AdminBanRange)
+	http.HandleFunc("POST /admin/unbanrange", pages.AdminUnbanRange)
+
+	http.HandleFunc("GET /admin/queue", pages.Queue)
+	http.HandleFunc("POST /admin/queue/approve", pages.AdminApprove)
+	http.HandleFunc("POST /admin/queue/reject", pages.AdminReject)
+
+	http.HandleFunc("GET /admin/reports", pages.Reports)
+	http.HandleFunc("POST /admin/reports/dismiss", pages.AdminDismissReports)
+
+	http.HandleFunc("GET /admin/appeals", pages.Appeals)
+	http.HandleFunc("POST /admin/appeals/resolve", pages.AdminResolveAppeal)
+
+	http.HandleFunc("GET /admin/filters", pages.Filters)
+	http.HandleFunc("POST /admin/filters/add", pages.AdminAddFilter)
+	http.HandleFunc("POST /admin/filters/delete", pages.AdminDeleteFilter)
+
+	http.HandleFunc("GET /admin/tokens", pages.Tokens)
+	http.HandleFunc("POST /admin/tokens/add", pages.AdminAddToken)
+	http.HandleFunc("POST /admin/tokens/delete", pages.AdminDeleteToken)
+
+	http.HandleFunc("GET /admin/log", pages.AuditLog)
+	http.HandleFunc("GET /log", pages.ModLog)
 
+	http.HandleFunc("GET /admin/accounts", pages.Accounts)
+	http.HandleFunc("POST /admin/accounts/add", pages.AdminAddAccount)
+	http.HandleFunc("POST /admin/accounts/delete", pages.AdminDeleteAccount)
+
+	http.HandleFunc("GET /report/{id}", pages.ReportPost)
+	http.HandleFunc("POST /report", pages.NewReport)
+
+	http.HandleFunc("GET /banned", pages.Banned)
+	http.HandleFunc("POST /appeal", pages.NewAppeal)
+
+	http.HandleFunc("GET /captcha/{token}", pages.CaptchaImage)
+	http.HandleFunc("GET /pow", pages.PowChallenge)
 	http.HandleFunc("POST /newpost", pages.NewPost)
 
+	http.HandleFunc("OPTIONS /api/v1/", pages.APIPreflight)
+	http.HandleFunc("GET /api/v1/board", pages.APIBoard)
+	http.HandleFunc("GET /api/v1/threads", pages.APIThreads)
+	http.HandleFunc("GET /api/v1/threads/{id}", pages.APIThread)
+	http.HandleFunc("GET /api/v1/posts/{id}", pages.APIPost)
+	http.HandleFunc("POST /api/v1/posts", pages.APINewPost)
+	http.HandleFunc("GET /api/v1/captcha", pages.APICaptcha)
+	http.HandleFunc("GET /api/v1/catalog", pages.APICatalog)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", Config.Port))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if Config.ProxyProtocol {
+		listener = proxyListener{listener}
+	}
+
 	log.Printf("now listening on port %d", Config.Port)
 
-	err = http.ListenAndServe(fmt.Sprintf(":%d", Config.Port), nil)
+	err = http.Serve(listener, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -112,6 +267,12 @@ func checkKey() error {
 	return nil
 }
 
+func every(interval time.Duration, f func()) {
+	for range time.Tick(interval) {
+		f()
+	}
+}
+
 func cache(h http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasSuffix(r.URL.Path, "/") {
@@ -0,0 +1,156 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	. "github.com/patapancakes/tanuki/config"
+	. "github.com/patapancakes/tanuki/db"
+)
+
+type AccountsData struct {
+	Staff Staff
+
+	Accounts AccountData
+	Roles    []Role
+}
+
+var accountsT *template.Template
+
+func Accounts(w http.ResponseWriter, r *http.Request) {
+	var ad AccountsData
+	var err error
+
+	ad.Staff, err = checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !ad.Staff.Role.CanConfig() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	ad.Accounts, err = accounts.GetAll()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch accounts: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	ad.Roles = Roles
+
+	err = accountsT.Execute(w, ad)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func AdminAddAccount(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanConfig() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+
+	err = AddAccount(name, Role(r.FormValue("role")), r.FormValue("password"))
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to add account: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/accounts", http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("added account \"%s\" with role \"%s\"", name, r.FormValue("role")))
+	writeAudit(staff, AuditEntry{Action: "add account", Reason: fmt.Sprintf("%s (%s)", name, r.FormValue("role"))})
+}
+
+func AdminDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanConfig() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to parse request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	names, ok := r.Form["name"]
+	if !ok {
+		writeError(w, r, "no accounts specified", http.StatusBadRequest)
+		return
+	}
+
+	for _, name := range names {
+		if name == staff.Name {
+			writeError(w, r, "you cannot delete your own account", http.StatusBadRequest)
+			return
+		}
+
+		err = accounts.Delete(name)
+		if err != nil && err != ErrUnknownAccount {
+			writeError(w, r, fmt.Sprintf("failed to delete account: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeAudit(staff, AuditEntry{Action: "delete account", Reason: name})
+	}
+
+	http.Redirect(w, r, "/admin/accounts", http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("deleted account(s) \"%s\"", names))
+}
+
+// AddAccount creates or replaces the staff account with the given name
+func AddAccount(name string, role Role, password string) error {
+	if name == "" || !utf8.ValidString(name) || utf8.RuneCountInString(name) > Config.MaxNameSize {
+		return fmt.Errorf("invalid name")
+	}
+	if !role.IsValid() {
+		return fmt.Errorf("invalid role \"%s\"", role)
+	}
+	if password == "" {
+		return fmt.Errorf("a password is required")
+	}
+
+	account, err := NewAccount(role, password)
+	if err != nil {
+		return err
+	}
+
+	return accounts.Add(name, account)
+}
@@ -19,10 +19,13 @@
 package pages
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/netip"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -33,11 +36,6 @@ import (
 var loginT *template.Template
 
 func Login(w http.ResponseWriter, r *http.Request) {
-	if Config.AdminPassword == "" {
-		writeError(w, r, "admin password not set", http.StatusForbidden)
-		return
-	}
-
 	err := loginT.Execute(w, r.Referer())
 	if err != nil {
 		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
@@ -46,11 +44,6 @@ func Login(w http.ResponseWriter, r *http.Request) {
 }
 
 func AdminLogin(w http.ResponseWriter, r *http.Request) {
-	if Config.AdminPassword == "" {
-		writeError(w, r, "admin password not set", http.StatusForbidden)
-		return
-	}
-
 	// rate limiting
 	identity, err := deriveIdentity(r)
 	if err != nil {
@@ -58,13 +51,15 @@ func AdminLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	poster, err := posters.Get(identity)
+	poster, err := getPoster(r, identity)
 	if err != nil && err != ErrUnknownPoster {
 		writeError(w, r, fmt.Sprintf("failed to look up poster info: %s", err), http.StatusInternalServerError)
 		return
 	}
+
+	// range bans are left out so a range that's too broad can't lock staff out
 	if poster.IsBanned() {
-		writeError(w, r, "you are banned", http.StatusForbidden)
+		http.Redirect(w, r, "/banned", http.StatusSeeOther)
 		return
 	}
 	if poster.LastLogin.Add(time.Second * time.Duration(Config.LoginCooldown)).After(time.Now()) {
@@ -81,8 +76,15 @@ func AdminLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check password
-	if r.FormValue("password") != Config.AdminPassword {
-		writeError(w, r, "incorrect password", http.StatusUnauthorized)
+	name := r.FormValue("name")
+
+	account, err := accounts.Get(name)
+	if err != nil && err != ErrUnknownAccount {
+		writeError(w, r, fmt.Sprintf("failed to look up account: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if err == ErrUnknownAccount || !account.CheckPassword(r.FormValue("password")) {
+		writeError(w, r, "incorrect name or password", http.StatusUnauthorized)
 		return
 	}
 
@@ -92,10 +94,13 @@ func AdminLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		Subject:   identity,
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, sessionClaims{
+		Account: name,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   identity,
+		},
 	}).SignedString(key)
 	if err != nil {
 		writeError(w, r, fmt.Sprintf("failed to sign token: %s", err), http.StatusInternalServerError)
@@ -118,7 +123,7 @@ func AdminLogin(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, redirect, http.StatusSeeOther)
 
-	writeLog(r, "logged in as admin")
+	writeLog(r, fmt.Sprintf("logged in as \"%s\"", name))
 }
 
 func AdminLogout(w http.ResponseWriter, r *http.Request) {
@@ -139,15 +144,74 @@ func AdminLogout(w http.ResponseWriter, r *http.Request) {
 }
 
 func AdminDelete(w http.ResponseWriter, r *http.Request) {
-	err := checkAuth(r)
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanDelete() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	post, err := posts.Get(r.FormValue("id"))
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch post: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	scope := r.FormValue("scope")
+	if scope == "" {
+		scope = "post"
+	}
+
+	err = checkScope(post, scope)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := scopePosts(post, scope)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch posts: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = deletePosts(post, scope)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to delete posts: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	redirect := r.FormValue("referer")
+	if redirect == "" {
+		redirect = "/"
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("deleted %s of post with id \"%s\"", scope, post.ID()))
+	for _, p := range deleted {
+		writeAudit(staff, AuditEntry{Action: deleteActions[scope], Post: p.ID(), Poster: p.Poster, Reason: r.FormValue("reason"), Snapshot: &p})
+	}
+}
+
+func AdminUndelete(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
 	if err != nil {
 		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
 		return
 	}
+	if !staff.Role.CanDelete() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	id := r.FormValue("id")
 
-	err = posts.Delete(r.FormValue("id"))
+	err = posts.Undelete(id)
 	if err != nil {
-		writeError(w, r, fmt.Sprintf("failed to delete post: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Sprintf("failed to undelete post: %s", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -158,15 +222,20 @@ func AdminDelete(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, redirect, http.StatusSeeOther)
 
-	writeLog(r, fmt.Sprintf("deleted post with id \"%s\"", r.FormValue("id")))
+	writeLog(r, fmt.Sprintf("undeleted post with id \"%s\"", id))
+	writeAudit(staff, AuditEntry{Action: "undelete", Post: id, Reason: r.FormValue("reason")})
 }
 
 func AdminBan(w http.ResponseWriter, r *http.Request) {
-	err := checkAuth(r)
+	staff, err := checkAuth(r)
 	if err != nil {
 		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
 		return
 	}
+	if !staff.Role.CanBan() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
 
 	post, err := posts.Get(r.FormValue("id"))
 	if err != nil {
@@ -174,8 +243,20 @@ func AdminBan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if post.Poster == "admin" {
-		writeError(w, r, "admin cannot be banned", http.StatusBadRequest)
+	if post.IsStaff() {
+		writeError(w, r, "staff cannot be banned", http.StatusBadRequest)
+		return
+	}
+	if post.Poster == "" {
+		writeError(w, r, "the poster of this post is no longer known", http.StatusBadRequest)
+		return
+	}
+
+	scope := r.FormValue("scope")
+
+	err = checkScope(post, scope)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -187,6 +268,25 @@ func AdminBan(w http.ResponseWriter, r *http.Request) {
 
 	poster.BanTime = time.Now()
 	poster.BanReason = r.FormValue("reason")
+	poster.BanExpiry = time.Time{}
+	banPost := post.WithoutPosters()
+	poster.BanPost = &banPost
+	poster.BanShadow = r.FormValue("shadow") != ""
+
+	if poster.BanShadow && r.FormValue("notice") != "" {
+		writeError(w, r, "shadow bans can't have a public notice", http.StatusBadRequest)
+		return
+	}
+
+	if r.FormValue("duration") != "" {
+		duration, err := time.ParseDuration(r.FormValue("duration"))
+		if err != nil || duration <= 0 {
+			writeError(w, r, "invalid ban duration", http.StatusBadRequest)
+			return
+		}
+
+		poster.BanExpiry = poster.BanTime.Add(duration)
+	}
 
 	err = posters.Add(post.Poster, poster)
 	if err != nil {
@@ -194,9 +294,25 @@ func AdminBan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = posts.DeletePoster(post.Poster)
+	if r.FormValue("notice") != "" {
+		post.BanNotice = true
+
+		err = posts.Update(post)
+		if err != nil {
+			writeError(w, r, fmt.Sprintf("failed to update post: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	deleted, err := scopePosts(post, scope)
 	if err != nil {
-		writeError(w, r, fmt.Sprintf("failed to delete poster posts: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Sprintf("failed to fetch posts: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = deletePosts(post, scope)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to delete posts: %s", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -207,15 +323,96 @@ func AdminBan(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, redirect, http.StatusSeeOther)
 
-	writeLog(r, fmt.Sprintf("banned poster with id \"%s\" for reason \"%s\"", post.Poster, poster.BanReason))
+	action, banText := "ban", "banned"
+	if poster.BanShadow {
+		action, banText = "shadow ban", "shadow banned"
+	}
+
+	writeLog(r, fmt.Sprintf("%s poster with id \"%s\" for reason \"%s\" until %s", banText, post.Poster, poster.BanReason, banUntil(poster.BanExpiry)))
+	writeAudit(staff, AuditEntry{Action: action, Post: post.ID(), Poster: post.Poster, Reason: poster.BanReason, Snapshot: &post})
+	for _, p := range deleted {
+		writeAudit(staff, AuditEntry{Action: deleteActions[scope], Post: p.ID(), Poster: p.Poster, Reason: poster.BanReason, Snapshot: &p})
+	}
+}
+
+// deleteActions maps the scopes a deletion can cover to their audit log actions
+var deleteActions = map[string]string{
+	"post":   "delete",
+	"all":    "delete all",
+	"images": "delete images",
+}
+
+// checkScope validates a deletion scope, where an empty scope deletes nothing
+func checkScope(post Post, scope string) error {
+	if scope == "" {
+		return nil
+	}
+
+	if _, ok := deleteActions[scope]; !ok {
+		return errors.New("invalid deletion scope")
+	}
+
+	// staff posts and posts past the poster retention period aren't tied to a poster id,
+	// legacy staff posts all share the "admin" poster id
+	if scope != "post" && (post.IsStaff() || post.Poster == "") {
+		return errors.New("staff posts and posts without a known poster can only be deleted individually")
+	}
+
+	return nil
+}
+
+// scopePosts returns the posts a deletion scope covers, so each can be snapshotted in the audit log
+func scopePosts(post Post, scope string) ([]Post, error) {
+	switch scope {
+	case "":
+		return nil, nil
+	case "post":
+		return []Post{post}, nil
+	}
+
+	all, err := posts.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var covered []Post
+	for _, thread := range all {
+		for _, p := range append([]Post{thread}, thread.Replies...) {
+			if p.Poster != post.Poster || p.IsDeleted() || (scope == "images" && (!p.Image || p.IsImageDeleted())) {
+				continue
+			}
+
+			covered = append(covered, p)
+		}
+	}
+
+	return covered, nil
+}
+
+// deletePosts removes the post, every post by its poster, or only the poster's images
+func deletePosts(post Post, scope string) error {
+	switch scope {
+	case "post":
+		return posts.Delete(post.ID())
+	case "all":
+		return posts.DeletePoster(post.Poster)
+	case "images":
+		return posts.DeletePosterImages(post.Poster)
+	}
+
+	return nil
 }
 
 func AdminUnbanID(w http.ResponseWriter, r *http.Request) {
-	err := checkAuth(r)
+	staff, err := checkAuth(r)
 	if err != nil {
 		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
 		return
 	}
+	if !staff.Role.CanUnban() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
 
 	err = r.ParseForm()
 	if err != nil {
@@ -236,13 +433,15 @@ func AdminUnbanID(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		poster.BanTime = time.Time{}
+		poster.Unban()
 
 		err = posters.Add(id, poster)
 		if err != nil {
 			writeError(w, r, fmt.Sprintf("failed to insert poster: %s", err), http.StatusInternalServerError)
 			return
 		}
+
+		writeAudit(staff, AuditEntry{Action: "unban", Poster: id})
 	}
 
 	redirect := r.Referer()
@@ -254,3 +453,162 @@ func AdminUnbanID(w http.ResponseWriter, r *http.Request) {
 
 	writeLog(r, fmt.Sprintf("unbanned poster(s) with id(s) \"%s\"", ids))
 }
+
+// AdminConvertBan turns shadow bans into normal bans, keeping their reason and expiry
+func AdminConvertBan(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanBan() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to parse request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	ids, ok := r.Form["id"]
+	if !ok {
+		writeError(w, r, "no ids specified", http.StatusBadRequest)
+		return
+	}
+
+	var converted []string
+	for _, id := range ids {
+		poster, err := posters.Get(id)
+		if err != nil && err != ErrUnknownPoster {
+			writeError(w, r, fmt.Sprintf("failed to look up poster info: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if !poster.IsShadowBanned() {
+			continue
+		}
+
+		poster.BanShadow = false
+
+		err = posters.Add(id, poster)
+		if err != nil {
+			writeError(w, r, fmt.Sprintf("failed to insert poster: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		converted = append(converted, id)
+
+		writeAudit(staff, AuditEntry{Action: "convert ban", Poster: id, Reason: poster.BanReason})
+	}
+
+	redirect := r.Referer()
+	if redirect == "" {
+		redirect = "/"
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("converted shadow ban(s) of poster(s) with id(s) \"%s\"", converted))
+}
+
+// ranges broader than these can only be banned by admins
+const (
+	minRangeBits4 = 16
+	minRangeBits6 = 32
+)
+
+func AdminBanRange(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanBan() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	text := strings.TrimSpace(r.FormValue("range"))
+
+	prefix, err := netip.ParsePrefix(text)
+	if err != nil {
+		addr, err := netip.ParseAddr(text)
+		if err != nil {
+			writeError(w, r, "invalid address range", http.StatusBadRequest)
+			return
+		}
+
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	minBits := minRangeBits4
+	if prefix.Addr().Is6() {
+		minBits = minRangeBits6
+	}
+	if prefix.Bits() < minBits && !staff.Role.CanConfig() {
+		writeError(w, r, fmt.Sprintf("ranges broader than /%d need an admin", minBits), http.StatusForbidden)
+		return
+	}
+
+	ban := RangeBan{BanTime: time.Now(), BanReason: r.FormValue("reason")}
+
+	if r.FormValue("duration") != "" {
+		duration, err := time.ParseDuration(r.FormValue("duration"))
+		if err != nil || duration <= 0 {
+			writeError(w, r, "invalid ban duration", http.StatusBadRequest)
+			return
+		}
+
+		ban.BanExpiry = ban.BanTime.Add(duration)
+	}
+
+	err = rangeBans.Add(prefix, ban)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to insert range ban: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/bans", http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("banned range \"%s\" for reason \"%s\" until %s", prefix.Masked(), ban.BanReason, banUntil(ban.BanExpiry)))
+	writeAudit(staff, AuditEntry{Action: "ban range", Poster: prefix.Masked().String(), Reason: ban.BanReason})
+}
+
+func AdminUnbanRange(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanUnban() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to parse request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	ranges, ok := r.Form["range"]
+	if !ok {
+		writeError(w, r, "no ranges specified", http.StatusBadRequest)
+		return
+	}
+
+	for _, prefix := range ranges {
+		err = rangeBans.Delete(prefix)
+		if err != nil && err != ErrUnknownRange {
+			writeError(w, r, fmt.Sprintf("failed to delete range ban: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeAudit(staff, AuditEntry{Action: "unban range", Poster: prefix})
+	}
+
+	http.Redirect(w, r, "/admin/bans", http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("unbanned range(s) \"%s\"", ranges))
+}
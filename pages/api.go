@@ -0,0 +1,470 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/patapancakes/tanuki/config"
+	. "github.com/patapancakes/tanuki/db"
+)
+
+// The v1 api only ever adds fields, existing names and meanings don't change.
+// Errors come back as {"error": {"code": "...", "message": "..."}}.
+
+// APIBoardData describes the board and the limits posts must fit in
+type APIBoardData struct {
+	Name           string   `json:"name"`
+	Slogans        []string `json:"slogans"`
+	Rules          []string `json:"rules"`
+	MaxNameSize    int      `json:"maxNameSize"`    // in characters
+	MaxSubjectSize int      `json:"maxSubjectSize"` // in characters
+	MaxCommentSize int      `json:"maxCommentSize"` // in characters
+	MaxAltSize     int      `json:"maxAltSize"`     // in characters
+	MaxUploadSize  float32  `json:"maxUploadSize"`  // in megabytes
+	ImageTypes     []string `json:"imageTypes"`     // mime types accepted for uploads
+	ThreadsPerPage int      `json:"threadsPerPage"`
+	MaxPages       int      `json:"maxPages"`
+	MaxBumps       int      `json:"maxBumps"` // replies after this many no longer bump the thread
+	StaffPostOnly  bool     `json:"staffPostOnly"`
+	Captcha        string   `json:"captcha,omitempty"` // which posts need a captcha: threads, replies, all or new
+	ProofOfWork    bool     `json:"proofOfWork"`       // posts need a solved challenge from /pow
+}
+
+// APIPostData is a post as the api shows it, with the same field names as stored posts
+type APIPostData struct {
+	ID            string    `json:"id"`
+	Parent        string    `json:"parent,omitempty"`  // thread id, empty for threads
+	Name          string    `json:"name,omitempty"`    // empty for anonymous posts
+	Subject       string    `json:"subject,omitempty"` // threads only
+	Body          string    `json:"body,omitempty"`    // plain text as submitted
+	Image         bool      `json:"image,omitempty"`
+	Animated      bool      `json:"animated,omitempty"`
+	AnimatedThumb bool      `json:"animatedThumb,omitempty"` // the thumbnail is animated too
+	Spoiler       bool      `json:"spoiler,omitempty"`
+	ImageAlt      string    `json:"imageAlt,omitempty"`
+	FullURL       string    `json:"fullURL,omitempty"`  // may be relative to the board
+	ThumbURL      string    `json:"thumbURL,omitempty"` // may be relative to the board
+	Staff         string    `json:"staff,omitempty"`    // name of the staff account that made the post
+	BanNotice     bool      `json:"banNotice,omitempty"`
+	Pending       bool      `json:"pending,omitempty"` // awaiting approval, only ever set in the response to creating a post
+	Posted        time.Time `json:"posted"`
+
+	// threads only
+	Bumped     time.Time     `json:"bumped,omitzero"`
+	ReplyCount int           `json:"replyCount,omitempty"`
+	ImageCount int           `json:"imageCount,omitempty"` // images in replies
+	Replies    []APIPostData `json:"replies,omitempty"`    // only for full threads
+}
+
+// APIThreadsData is a page of threads in bump order
+type APIThreadsData struct {
+	Page    int           `json:"page"`
+	Pages   int           `json:"pages"`
+	Threads []APIPostData `json:"threads"`
+}
+
+// APINewPostData is a post submitted to the api, images are base64 encoded
+type APINewPostData struct {
+	Parent   string `json:"parent"` // thread id, empty to start a thread
+	Name     string `json:"name"`
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`
+	Image    []byte `json:"image"`
+	Spoiler  bool   `json:"spoiler"`
+	ImageAlt string `json:"imageAlt"`
+
+	// only needed without a trusted token
+	CaptchaToken string `json:"captchaToken"`
+	Captcha      string `json:"captcha"`
+	PowToken     string `json:"powToken"`
+	PowNonce     string `json:"powNonce"`
+}
+
+// APICaptchaData is a captcha challenge, either the image or the question can be answered
+type APICaptchaData struct {
+	Token    string `json:"token"`
+	ImageURL string `json:"imageURL"`
+	Question string `json:"question,omitempty"`
+}
+
+type APIErrorData struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// newAPIPost converts a post, only the fields listed above ever leave the server
+func newAPIPost(post Post) APIPostData {
+	ap := APIPostData{
+		ID:            post.ID(),
+		Parent:        post.Parent,
+		Name:          post.Name,
+		Subject:       post.Subject,
+		Body:          post.Body,
+		Image:         post.Image,
+		Animated:      post.Animated,
+		AnimatedThumb: post.AnimatedThumb,
+		Spoiler:       post.Spoiler,
+		ImageAlt:      post.ImageAlt,
+		Staff:         post.Staff,
+		BanNotice:     post.BanNotice,
+		Pending:       post.Pending,
+		Posted:        post.Posted,
+	}
+
+	if post.IsStaff() && ap.Staff == "" {
+		ap.Staff = "admin"
+	}
+
+	if post.Image {
+		ap.FullURL = mediaURL(post, post.FullPath())
+		ap.ThumbURL = mediaURL(post, post.ThumbPath())
+	}
+
+	if post.IsThread() {
+		ap.Bumped = post.Bumped(Config.MaxBumps)
+		ap.ReplyCount = len(post.Replies)
+		for _, reply := range post.Replies {
+			if reply.Image {
+				ap.ImageCount++
+			}
+		}
+	}
+
+	return ap
+}
+
+// setAPIHeaders allows the configured origins to read api responses from browsers
+func setAPIHeaders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+
+	if slices.Contains(Config.APIOrigins, "*") {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else if slices.Contains(Config.APIOrigins, origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	} else {
+		return
+	}
+
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+}
+
+// writeJSON sends v with an ETag, answering with 304 Not Modified if the client already has it
+func writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	setAPIHeaders(w, r)
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeAPIError(w, r, "internal", fmt.Sprintf("failed to encode response: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", etag)
+
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+		if match == etag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Write(append(body, '\n'))
+}
+
+func writeAPIError(w http.ResponseWriter, r *http.Request, code string, message string, status int) {
+	setAPIHeaders(w, r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(struct {
+		Error APIErrorData `json:"error"`
+	}{APIErrorData{Code: code, Message: message}})
+
+	writeLog(r, message)
+}
+
+// apiPosts fetches every thread visible to the requester
+func apiPosts(w http.ResponseWriter, r *http.Request) (PostData, bool) {
+	identity, err := deriveIdentity(r)
+	if err != nil {
+		writeAPIError(w, r, "internal", fmt.Sprintf("failed to derive identity: %s", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	all, err := posts.GetAll()
+	if err != nil {
+		writeAPIError(w, r, "internal", fmt.Sprintf("failed to fetch posts: %s", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return filterPosts(all, Staff{}, identity), true
+}
+
+// APIPreflight answers CORS preflight requests for the api
+func APIPreflight(w http.ResponseWriter, r *http.Request) {
+	setAPIHeaders(w, r)
+
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-None-Match")
+	w.Header().Set("Access-Control-Max-Age", "86400")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func APIBoard(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, APIBoardData{
+		Name:           Config.SiteName,
+		Slogans:        append([]string{}, Config.SiteSlogans...),
+		Rules:          append([]string{}, Config.SiteRules...),
+		MaxNameSize:    Config.MaxNameSize,
+		MaxSubjectSize: Config.MaxSubjectSize,
+		MaxCommentSize: Config.MaxCommentSize,
+		MaxAltSize:     Config.MaxAltSize,
+		MaxUploadSize:  Config.MaxUploadSize,
+		ImageTypes:     strings.Split(accept, ", "),
+		ThreadsPerPage: Config.MaxPostsPerPage,
+		MaxPages:       Config.MaxPages,
+		MaxBumps:       Config.MaxBumps,
+		StaffPostOnly:  Config.AdminPostOnly,
+		Captcha:        Config.Captcha,
+		ProofOfWork:    Config.ProofOfWork,
+	})
+}
+
+func APIThreads(w http.ResponseWriter, r *http.Request) {
+	threads, ok := apiPosts(w, r)
+	if !ok {
+		return
+	}
+
+	resp := APIThreadsData{Page: 1, Pages: 1, Threads: []APIPostData{}}
+	if r.FormValue("page") != "" {
+		page, err := strconv.Atoi(r.FormValue("page"))
+		if err != nil || page < 1 {
+			writeAPIError(w, r, "invalid_page", "invalid page", http.StatusBadRequest)
+			return
+		}
+
+		resp.Page = page
+	}
+
+	if len(threads) > Config.MaxPostsPerPage {
+		resp.Pages = int(math.Ceil(float64(len(threads)) / float64(Config.MaxPostsPerPage)))
+	}
+	if resp.Page > resp.Pages {
+		writeAPIError(w, r, "invalid_page", "page out of range", http.StatusNotFound)
+		return
+	}
+
+	threads = threads[min((resp.Page-1)*Config.MaxPostsPerPage, len(threads)):]
+	threads = threads[:min(Config.MaxPostsPerPage, len(threads))]
+
+	for _, thread := range threads {
+		resp.Threads = append(resp.Threads, newAPIPost(thread))
+	}
+
+	writeJSON(w, r, resp)
+}
+
+func APICatalog(w http.ResponseWriter, r *http.Request) {
+	threads, ok := apiPosts(w, r)
+	if !ok {
+		return
+	}
+
+	catalog := []APIPostData{}
+	for _, thread := range threads {
+		catalog = append(catalog, newAPIPost(thread))
+	}
+
+	writeJSON(w, r, catalog)
+}
+
+func APIThread(w http.ResponseWriter, r *http.Request) {
+	threads, ok := apiPosts(w, r)
+	if !ok {
+		return
+	}
+
+	i := slices.IndexFunc(threads, func(thread Post) bool { return thread.ID() == r.PathValue("id") })
+	if i == -1 {
+		writeAPIError(w, r, "not_found", "thread not found", http.StatusNotFound)
+		return
+	}
+
+	thread := newAPIPost(threads[i])
+	for _, reply := range threads[i].Replies {
+		thread.Replies = append(thread.Replies, newAPIPost(reply))
+	}
+
+	writeJSON(w, r, thread)
+}
+
+func APIPost(w http.ResponseWriter, r *http.Request) {
+	threads, ok := apiPosts(w, r)
+	if !ok {
+		return
+	}
+
+	for _, thread := range threads {
+		if thread.ID() == r.PathValue("id") {
+			writeJSON(w, r, newAPIPost(thread))
+			return
+		}
+
+		for _, reply := range thread.Replies {
+			if reply.ID() == r.PathValue("id") {
+				writeJSON(w, r, newAPIPost(reply))
+				return
+			}
+		}
+	}
+
+	writeAPIError(w, r, "not_found", "post not found", http.StatusNotFound)
+}
+
+// APINewPost creates a post, checked the same way as posts from the post form
+func APINewPost(w http.ResponseWriter, r *http.Request) {
+	// base64 takes four bytes for every three of the image
+	r.Body = http.MaxBytesReader(w, r.Body, int64(Config.MaxUploadSize*1024*1024)*4/3+64*1024)
+
+	token, hash, err := checkToken(r)
+	if err != nil {
+		if err == ErrUnknownToken {
+			writeAPIError(w, r, "invalid_token", "invalid api token", http.StatusUnauthorized)
+			return
+		}
+
+		writeAPIError(w, r, "internal", fmt.Sprintf("failed to look up token: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	var req APINewPostData
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeAPIError(w, r, "invalid_request", fmt.Sprintf("failed to decode request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if hash != "" {
+		scope := ScopeThreads
+		if req.Parent != "" {
+			scope = ScopeReplies
+		}
+
+		if !token.HasScope(scope) {
+			writeAPIError(w, r, "insufficient_scope", fmt.Sprintf("token \"%s\" is missing the \"%s\" scope", token.Name, scope), http.StatusForbidden)
+			return
+		}
+		if !tokenLimits.Allow(hash, token.RateLimit) {
+			writeAPIError(w, r, "rate_limited", fmt.Sprintf("token \"%s\" is limited to %d posts per hour", token.Name, token.RateLimit), http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	pr := postRequest{
+		Parent:       req.Parent,
+		Name:         req.Name,
+		Subject:      req.Subject,
+		Body:         req.Body,
+		Spoiler:      req.Spoiler,
+		ImageAlt:     req.ImageAlt,
+		CaptchaToken: req.CaptchaToken,
+		Captcha:      req.Captcha,
+		PowToken:     req.PowToken,
+		PowNonce:     req.PowNonce,
+	}
+	if len(req.Image) != 0 {
+		pr.Image = bytes.NewReader(req.Image)
+	}
+
+	post, id, perr := submitPost(r, Staff{}, token, pr)
+	if perr != nil {
+		writeAPIError(w, r, perr.Code, perr.Message, perr.Status)
+		return
+	}
+
+	// only posts that were made count towards the limit
+	if hash != "" {
+		tokenLimits.Record(hash, token.RateLimit)
+	}
+
+	// pending posts can't be fetched until they're approved
+	status := http.StatusCreated
+	if post.Pending {
+		status = http.StatusAccepted
+	} else {
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/posts/%s", id))
+	}
+
+	setAPIHeaders(w, r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(newAPIPost(post))
+}
+
+// APICaptcha issues a captcha for api clients posting without a trusted token
+func APICaptcha(w http.ResponseWriter, r *http.Request) {
+	identity, err := deriveIdentity(r)
+	if err != nil {
+		writeAPIError(w, r, "internal", fmt.Sprintf("failed to derive identity: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	captcha, err := newCaptcha(identity)
+	if err != nil {
+		writeAPIError(w, r, "internal", fmt.Sprintf("failed to create captcha: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	setAPIHeaders(w, r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	json.NewEncoder(w).Encode(APICaptchaData{
+		Token:    captcha.Token,
+		ImageURL: fmt.Sprintf("/captcha/%s", captcha.Token),
+		Question: captcha.Question,
+	})
+}
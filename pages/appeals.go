@@ -0,0 +1,145 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	. "github.com/patapancakes/tanuki/config"
+	. "github.com/patapancakes/tanuki/db"
+)
+
+type AppealsData struct {
+	Staff Staff
+
+	Appeals AppealData
+	Banned  PosterData
+}
+
+var appealsT *template.Template
+
+func Appeals(w http.ResponseWriter, r *http.Request) {
+	var ad AppealsData
+	var err error
+
+	ad.Staff, err = checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !ad.Staff.Role.CanUnban() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	ad.Appeals, err = appeals.GetPending()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch appeals: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	ad.Banned, err = posters.GetBanned()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to get banned posters: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = appealsT.Execute(w, ad)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func AdminResolveAppeal(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanUnban() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	id := r.FormValue("id")
+
+	appeal, err := appeals.Get(id)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch appeal: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if !appeal.IsPending() {
+		writeError(w, r, "appeal has already been resolved", http.StatusBadRequest)
+		return
+	}
+
+	appeal.Response = strings.TrimSpace(r.FormValue("response"))
+	if !utf8.ValidString(appeal.Response) || utf8.RuneCountInString(appeal.Response) > Config.MaxCommentSize {
+		writeError(w, r, "invalid response", http.StatusBadRequest)
+		return
+	}
+
+	appeal.Responder = staff.Name
+	appeal.Resolved = time.Now()
+
+	switch r.FormValue("action") {
+	case "accept":
+		appeal.Status = AppealAccepted
+
+		poster, err := posters.Get(id)
+		if err != nil && err != ErrUnknownPoster {
+			writeError(w, r, fmt.Sprintf("failed to look up poster info: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		// a newer ban isn't covered by this appeal
+		if poster.BanTime.Equal(appeal.BanTime) {
+			poster.Unban()
+
+			err = posters.Add(id, poster)
+			if err != nil {
+				writeError(w, r, fmt.Sprintf("failed to insert poster: %s", err), http.StatusInternalServerError)
+				return
+			}
+		}
+	case "deny":
+		appeal.Status = AppealDenied
+	default:
+		writeError(w, r, "invalid action", http.StatusBadRequest)
+		return
+	}
+
+	err = appeals.Add(id, appeal)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to update appeal: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/appeals", http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("%s appeal from poster with id \"%s\"", appeal.Status, id))
+	writeAudit(staff, AuditEntry{Action: fmt.Sprintf("%s appeal", r.FormValue("action")), Poster: id, Reason: appeal.Response})
+}
@@ -0,0 +1,133 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+
+	. "github.com/patapancakes/tanuki/config"
+	. "github.com/patapancakes/tanuki/db"
+)
+
+type AuditLogData struct {
+	Staff Staff
+
+	Public  bool
+	Entries AuditData
+	Actions []string
+
+	Actor  string
+	Action string
+	Target string
+}
+
+var auditT *template.Template
+
+// privateActions never appear on the public log, they would tell a shadow banned
+// poster about the ban
+var privateActions = map[string]bool{
+	"shadow ban":  true,
+	"convert ban": true,
+}
+
+func AuditLog(w http.ResponseWriter, r *http.Request) {
+	var ad AuditLogData
+	var err error
+
+	ad.Staff, err = checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !ad.Staff.Role.CanDelete() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	entries, err := audit.GetAll()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch audit log: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	ad.Actor = strings.TrimSpace(r.FormValue("actor"))
+	ad.Action = r.FormValue("action")
+	ad.Target = strings.TrimSpace(r.FormValue("target"))
+
+	for _, entry := range entries {
+		if !slices.Contains(ad.Actions, entry.Action) {
+			ad.Actions = append(ad.Actions, entry.Action)
+		}
+
+		if ad.Actor != "" && entry.Actor != ad.Actor {
+			continue
+		}
+		if ad.Action != "" && entry.Action != ad.Action {
+			continue
+		}
+		if ad.Target != "" && entry.Post != ad.Target && entry.Poster != ad.Target && shortIdentity(entry.Poster) != ad.Target {
+			continue
+		}
+
+		ad.Entries = append(ad.Entries, entry)
+	}
+
+	slices.Sort(ad.Actions)
+
+	err = auditT.Execute(w, ad)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func ModLog(w http.ResponseWriter, r *http.Request) {
+	if !Config.PublicModLog {
+		writeError(w, r, "the moderation log is not public", http.StatusNotFound)
+		return
+	}
+
+	entries, err := audit.GetAll()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch audit log: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	ad := AuditLogData{Public: true}
+	for _, entry := range entries {
+		if entry.Post == "" && entry.Poster == "" {
+			continue // staff management
+		}
+		if privateActions[entry.Action] {
+			continue
+		}
+
+		ad.Entries = append(ad.Entries, entry.Redacted())
+	}
+
+	err = auditT.Execute(w, ad)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,61 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/patapancakes/tanuki/config"
+	. "github.com/patapancakes/tanuki/db"
+)
+
+func TestModLogShadowBan(t *testing.T) {
+	err := Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(a AuditDB, public bool) { audit, Config.PublicModLog = a, public }(audit, Config.PublicModLog)
+	audit = NewAuditJSON(filepath.Join(t.TempDir(), "audit.json"))
+	Config.PublicModLog = true
+
+	staff := Staff{Name: "mod"}
+	writeAudit(staff, AuditEntry{Action: "ban", Post: "1111", Poster: "open", Reason: "spam"})
+	writeAudit(staff, AuditEntry{Action: "shadow ban", Post: "2222", Poster: "quiet", Reason: "troll"})
+	writeAudit(staff, AuditEntry{Action: "convert ban", Poster: "quiet", Reason: "troll"})
+
+	w := httptest.NewRecorder()
+	ModLog(w, httptest.NewRequest("GET", "/log", nil))
+
+	body := w.Body.String()
+	if w.Code != 200 {
+		t.Fatalf("ModLog status = %d, want 200", w.Code)
+	}
+	if !strings.Contains(body, "1111") {
+		t.Errorf("public log is missing the open ban")
+	}
+	for _, leak := range []string{"shadow ban", "convert ban", "2222", "troll"} {
+		if strings.Contains(body, leak) {
+			t.Errorf("public log contains %q", leak)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	. "github.com/patapancakes/tanuki/config"
+	. "github.com/patapancakes/tanuki/db"
+)
+
+type BannedData struct {
+	Poster Poster
+
+	Range    string
+	RangeBan RangeBan
+
+	Appeal    Appeal
+	HasAppeal bool
+}
+
+var bannedT *template.Template
+
+func Banned(w http.ResponseWriter, r *http.Request) {
+	var bd BannedData
+
+	identity, err := deriveIdentity(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to derive identity: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	bd.Poster, err = getPoster(r, identity)
+	if err != nil && err != ErrUnknownPoster {
+		writeError(w, r, fmt.Sprintf("failed to look up poster info: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	addr, err := clientAddr(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to derive identity: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	bd.Range, bd.RangeBan, err = rangeBans.Match(addr)
+	if err != nil && err != ErrUnknownRange {
+		writeError(w, r, fmt.Sprintf("failed to look up bans: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	appeal, err := appeals.Get(identity)
+	if err != nil && err != ErrUnknownAppeal {
+		writeError(w, r, fmt.Sprintf("failed to look up appeal: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	// show the appeal for the current ban, or the outcome of the last one once it's lifted
+	bd.HasAppeal = err == nil && (appeal.BanTime.Equal(bd.Poster.BanTime) || !bd.Poster.IsBanned())
+	if bd.HasAppeal {
+		bd.Appeal = appeal
+	}
+
+	err = bannedT.Execute(w, bd)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func NewAppeal(w http.ResponseWriter, r *http.Request) {
+	identity, err := deriveIdentity(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to derive identity: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	poster, err := getPoster(r, identity)
+	if err != nil && err != ErrUnknownPoster {
+		writeError(w, r, fmt.Sprintf("failed to look up poster info: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if !poster.IsBanned() {
+		writeError(w, r, "you are not banned", http.StatusBadRequest)
+		return
+	}
+
+	appeal, err := appeals.Get(identity)
+	if err != nil && err != ErrUnknownAppeal {
+		writeError(w, r, fmt.Sprintf("failed to look up appeal: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err == nil && appeal.BanTime.Equal(poster.BanTime) {
+		writeError(w, r, "this ban has already been appealed", http.StatusBadRequest)
+		return
+	}
+
+	appeal = Appeal{BanTime: poster.BanTime, Time: time.Now(), Status: AppealPending}
+
+	appeal.Text = strings.TrimSpace(r.PostFormValue("appeal"))
+	if appeal.Text == "" || !utf8.ValidString(appeal.Text) || utf8.RuneCountInString(appeal.Text) > Config.MaxCommentSize {
+		writeError(w, r, "invalid appeal", http.StatusBadRequest)
+		return
+	}
+
+	err = appeals.Add(identity, appeal)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to insert appeal: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/banned", http.StatusSeeOther)
+
+	writeLog(r, "appealed ban")
+}
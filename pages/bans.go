@@ -22,24 +22,46 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+
+	. "github.com/patapancakes/tanuki/db"
 )
 
+type BansData struct {
+	Staff Staff
+
+	Banned PosterData
+	Ranges RangeBanData
+}
+
 var bansT *template.Template
 
 func Bans(w http.ResponseWriter, r *http.Request) {
-	err := checkAuth(r)
+	var bd BansData
+	var err error
+
+	bd.Staff, err = checkAuth(r)
 	if err != nil {
 		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
 		return
 	}
+	if !bd.Staff.Role.CanBan() && !bd.Staff.Role.CanUnban() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
 
-	banned, err := posters.GetBanned()
+	bd.Banned, err = posters.GetBanned()
 	if err != nil {
 		writeError(w, r, fmt.Sprintf("failed to get banned posters: %s", err), http.StatusInternalServerError)
 		return
 	}
 
-	err = bansT.Execute(w, banned)
+	bd.Ranges, err = rangeBans.GetAll()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to get range bans: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = bansT.Execute(w, bd)
 	if err != nil {
 		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
 		return
@@ -0,0 +1,313 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/patapancakes/tanuki/config"
+)
+
+const blocklistTimeout = time.Second * 2
+
+// Resolver looks up the addresses of a host, *net.Resolver satisfies it
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+var (
+	resolver Resolver = net.DefaultResolver
+
+	listings = listingCache{entries: make(map[string]cachedListing)}
+	torExits exitList
+)
+
+// newResolver returns a resolver querying server, or the system resolver if it's empty
+func newResolver(server string) Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// listing is what the blocklists say about an address
+type listing struct {
+	Lists   []string
+	Block   bool
+	Captcha bool
+	Hold    bool
+}
+
+func (l *listing) add(name string, action string) {
+	l.Lists = append(l.Lists, name)
+
+	switch action {
+	case "block":
+		l.Block = true
+	case "captcha":
+		l.Captcha = true
+	case "hold":
+		l.Hold = true
+	}
+}
+
+type cachedListing struct {
+	listing listing
+	expiry  time.Time
+}
+
+type listingCache struct {
+	mtx     sync.Mutex
+	entries map[string]cachedListing
+}
+
+func (c *listingCache) Get(identity string) (listing, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, ok := c.entries[identity]
+	if !ok || entry.expiry.Before(time.Now()) {
+		return listing{}, false
+	}
+
+	return entry.listing, true
+}
+
+func (c *listingCache) Set(identity string, l listing) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := time.Now()
+	for id, entry := range c.entries {
+		if entry.expiry.Before(now) {
+			delete(c.entries, id)
+		}
+	}
+
+	c.entries[identity] = cachedListing{listing: l, expiry: now.Add(time.Minute * time.Duration(Config.BlocklistCache))}
+}
+
+// blocklistCaptcha reports whether any configured list can require a captcha
+func blocklistCaptcha() bool {
+	if Config.TorExitList != "" && Config.TorExitAction == "captcha" {
+		return true
+	}
+
+	for _, list := range Config.Blocklists {
+		if list.Action == "captcha" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkBlocklists looks the request's address up on every configured blocklist,
+// lists that can't be reached are skipped so an outage doesn't stop posting
+func checkBlocklists(r *http.Request, identity string) (listing, error) {
+	if len(Config.Blocklists) == 0 && Config.TorExitList == "" {
+		return listing{}, nil
+	}
+
+	l, ok := listings.Get(identity)
+	if ok {
+		return l, nil
+	}
+
+	addr, err := clientAddr(r)
+	if err != nil {
+		return l, err
+	}
+
+	// every list is queried at once, sharing the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), blocklistTimeout)
+	defer cancel()
+
+	listed := make([]bool, len(Config.Blocklists))
+
+	var wg sync.WaitGroup
+	for i, list := range Config.Blocklists {
+		wg.Go(func() {
+			var err error
+			listed[i], err = lookupDNSBL(ctx, addr, list.Zone)
+			if err != nil {
+				log.Printf("failed to query blocklist \"%s\": %s", list.Zone, err)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	for i, list := range Config.Blocklists {
+		if listed[i] {
+			l.add(list.Zone, list.Action)
+		}
+	}
+
+	if Config.TorExitList != "" {
+		listed, err := torExits.Contains(addr)
+		if err != nil {
+			log.Printf("failed to read tor exit list: %s", err)
+		}
+
+		if listed {
+			l.add("tor", Config.TorExitAction)
+		}
+	}
+
+	listings.Set(identity, l)
+
+	return l, nil
+}
+
+// lookupDNSBL reports whether a DNSBL zone lists addr, which it does by answering with a loopback address
+func lookupDNSBL(ctx context.Context, addr netip.Addr, zone string) (bool, error) {
+	answers, err := resolver.LookupHost(ctx, dnsblName(addr, zone))
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	for _, answer := range answers {
+		ip, err := netip.ParseAddr(answer)
+		if err != nil {
+			continue
+		}
+
+		if !ip.Is4() || !ip.IsLoopback() {
+			continue
+		}
+
+		// 127.255.255.0/24 is used by some lists to report query errors, such as refusing public resolvers
+		if ip.As4()[1] == 255 {
+			return false, fmt.Errorf("blocklist returned error code %s", ip)
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// dnsblName reverses the octets of an IPv4 address, or the nibbles of an IPv6 address, under zone
+func dnsblName(addr netip.Addr, zone string) string {
+	addr = addr.Unmap()
+
+	var labels []string
+	if addr.Is4() {
+		b := addr.As4()
+		for i := len(b) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(b[i])))
+		}
+	} else {
+		b := addr.As16()
+		for i := len(b) - 1; i >= 0; i-- {
+			labels = append(labels, fmt.Sprintf("%x.%x", b[i]&0xf, b[i]>>4))
+		}
+	}
+
+	return strings.Join(labels, ".") + "." + strings.TrimSuffix(zone, ".")
+}
+
+// exitList holds the Tor exit addresses from Config.TorExitList, reloading it whenever the file changes
+type exitList struct {
+	mtx sync.Mutex
+
+	modified time.Time
+	addrs    map[netip.Addr]bool
+}
+
+func (e *exitList) Contains(addr netip.Addr) (bool, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	info, err := os.Stat(Config.TorExitList)
+	if err != nil {
+		return false, err
+	}
+
+	if !info.ModTime().Equal(e.modified) {
+		f, err := os.Open(Config.TorExitList)
+		if err != nil {
+			return false, err
+		}
+
+		defer f.Close()
+
+		e.addrs, err = parseExitList(f)
+		if err != nil {
+			return false, err
+		}
+
+		e.modified = info.ModTime()
+	}
+
+	return e.addrs[addr.Unmap()], nil
+}
+
+// parseExitList reads one address per line, ignoring blank lines, comments and anything after the address
+func parseExitList(r io.Reader) (map[netip.Addr]bool, error) {
+	addrs := make(map[netip.Addr]bool)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		// also accept the "ExitAddress <addr> <date>" lines of the exit-addresses format
+		if fields[0] == "ExitAddress" && len(fields) > 1 {
+			fields = fields[1:]
+		}
+
+		addr, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			continue
+		}
+
+		addrs[addr.Unmap()] = true
+	}
+
+	return addrs, scanner.Err()
+}
@@ -0,0 +1,261 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/patapancakes/tanuki/config"
+	. "github.com/patapancakes/tanuki/db"
+)
+
+// fakeResolver answers from a fixed set of names, anything else doesn't exist
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	answers, ok := f[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return answers, nil
+}
+
+// barrierResolver only answers once n lookups are waiting, so lookups made one at a time run into the timeout
+type barrierResolver struct {
+	n int
+
+	mtx     sync.Mutex
+	waiting int
+	ready   chan struct{}
+}
+
+func (b *barrierResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	b.mtx.Lock()
+	b.waiting++
+	if b.waiting == b.n {
+		close(b.ready)
+	}
+	b.mtx.Unlock()
+
+	select {
+	case <-b.ready:
+		return []string{"127.0.0.2"}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestDNSBLName(t *testing.T) {
+	tests := []struct {
+		addr string
+		zone string
+		want string
+	}{
+		{"192.0.2.1", "zen.example.org", "1.2.0.192.zen.example.org"},
+		{"10.20.30.40", "dnsbl.example.", "40.30.20.10.dnsbl.example"},
+		{"::ffff:192.0.2.1", "zen.example.org", "1.2.0.192.zen.example.org"},
+		{"2001:db8::1", "zen.example.org", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.zen.example.org"},
+		{"2001:db8:abcd:12::ff00", "v6.example", "0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.2.1.0.0.d.c.b.a.8.b.d.0.1.0.0.2.v6.example"},
+	}
+
+	for _, tt := range tests {
+		if got := dnsblName(netip.MustParseAddr(tt.addr), tt.zone); got != tt.want {
+			t.Errorf("dnsblName(%s, %q) = %q, want %q", tt.addr, tt.zone, got, tt.want)
+		}
+	}
+}
+
+func TestLookupDNSBL(t *testing.T) {
+	defer func(r Resolver) { resolver = r }(resolver)
+
+	resolver = fakeResolver{
+		"2.0.0.127.zen.example.org": {"127.0.0.2"},
+		"3.0.0.127.zen.example.org": {"127.0.0.10", "127.0.0.4"},
+		"4.0.0.127.zen.example.org": {"192.0.2.1"},
+		"5.0.0.127.zen.example.org": {"127.255.255.254"},
+		"6.0.0.127.zen.example.org": {"127.255.255.252"},
+		"7.0.0.127.zen.example.org": {"not an address", "127.0.0.3"},
+		"8.0.0.127.zen.example.org": {"::1"},
+	}
+
+	tests := []struct {
+		addr    string
+		listed  bool
+		wantErr bool
+	}{
+		{"127.0.0.1", false, false}, // nxdomain
+		{"127.0.0.2", true, false},
+		{"127.0.0.3", true, false},
+		{"127.0.0.4", false, false}, // not a loopback answer
+		{"127.0.0.5", false, true},  // public resolver refused
+		{"127.0.0.6", false, true},  // typing error
+		{"127.0.0.7", true, false},
+		{"127.0.0.8", false, false},
+	}
+
+	for _, tt := range tests {
+		listed, err := lookupDNSBL(context.Background(), netip.MustParseAddr(tt.addr), "zen.example.org")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("lookupDNSBL(%s) error = %v, want error %t", tt.addr, err, tt.wantErr)
+		}
+		if listed != tt.listed {
+			t.Errorf("lookupDNSBL(%s) = %t, want %t", tt.addr, listed, tt.listed)
+		}
+	}
+}
+
+func TestLookupDNSBLFailure(t *testing.T) {
+	defer func(r Resolver) { resolver = r }(resolver)
+
+	resolver = &barrierResolver{n: 2, ready: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := lookupDNSBL(ctx, netip.MustParseAddr("192.0.2.1"), "zen.example.org")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("lookupDNSBL with a failing resolver = %v, want context.Canceled", err)
+	}
+}
+
+func TestCheckBlocklistsConcurrent(t *testing.T) {
+	defer func(r Resolver, c ConfigFile) { resolver, Config = r, c }(resolver, Config)
+
+	Config.Blocklists = []Blocklist{
+		{Zone: "one.example", Action: "hold"},
+		{Zone: "two.example", Action: "captcha"},
+		{Zone: "three.example", Action: "block"},
+	}
+	Config.TorExitList = ""
+	Config.BlocklistCache = 0
+
+	resolver = &barrierResolver{n: len(Config.Blocklists), ready: make(chan struct{})}
+
+	r := httptest.NewRequest("POST", "/newpost", nil)
+	r.RemoteAddr = "198.51.100.1:1234"
+
+	l, err := checkBlocklists(r, "concurrent-test")
+	if err != nil {
+		t.Fatalf("checkBlocklists: %s", err)
+	}
+
+	want := []string{"one.example", "two.example", "three.example"}
+	if !slices.Equal(l.Lists, want) {
+		t.Errorf("checkBlocklists lists = %q, want %q", l.Lists, want)
+	}
+	if !l.Hold || !l.Captcha || !l.Block {
+		t.Errorf("checkBlocklists = %+v, want every action", l)
+	}
+}
+
+func TestBlocklistCaptcha(t *testing.T) {
+	defer func(c ConfigFile) { Config = c }(Config)
+
+	tests := []struct {
+		name       string
+		blocklists []Blocklist
+		torList    string
+		torAction  string
+		want       bool
+	}{
+		{"none", nil, "", "", false},
+		{"block and hold", []Blocklist{{Zone: "a.example", Action: "block"}, {Zone: "b.example", Action: "hold"}}, "", "", false},
+		{"captcha list", []Blocklist{{Zone: "a.example", Action: "block"}, {Zone: "b.example", Action: "captcha"}}, "", "", true},
+		{"tor captcha", nil, "exits.txt", "captcha", true},
+		{"tor captcha without a list", nil, "", "captcha", false},
+	}
+
+	for _, tt := range tests {
+		Config.Blocklists, Config.TorExitList, Config.TorExitAction = tt.blocklists, tt.torList, tt.torAction
+
+		if got := blocklistCaptcha(); got != tt.want {
+			t.Errorf("%s: blocklistCaptcha() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPostFormSkipsBlocklists(t *testing.T) {
+	defer func(r Resolver, c ConfigFile, p PosterDB) { resolver, Config, posters = r, c, p }(resolver, Config, posters)
+
+	Config.Blocklists = []Blocklist{{Zone: "list.example", Action: "hold"}}
+	Config.TorExitList = ""
+	Config.BlocklistCache = 60
+
+	resolver = fakeResolver{"1.100.51.198.list.example": {"127.0.0.2"}}
+	posters = NewPosterJSON(filepath.Join(t.TempDir(), "posters.json"))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "198.51.100.1:1234"
+
+	identity, err := deriveIdentity(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = newPostForm(r, Staff{}, "")
+	if err != nil {
+		t.Fatalf("newPostForm: %s", err)
+	}
+
+	if _, ok := listings.Get(identity); ok {
+		t.Errorf("newPostForm queried the blocklists")
+	}
+}
+
+func TestParseExitList(t *testing.T) {
+	list := strings.Join([]string{
+		"# exit list",
+		"",
+		"192.0.2.1",
+		"  198.51.100.7   # trailing comment",
+		"ExitNode 0011BD2485AD45D984EC4159C88FC066E5E3300E",
+		"Published 2025-01-01 00:00:00",
+		"ExitAddress 203.0.113.9 2025-01-01 00:10:00",
+		"2001:db8::1",
+		"::ffff:192.0.2.50",
+		"not-an-address",
+		"ExitAddress",
+	}, "\n")
+
+	addrs, err := parseExitList(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("parseExitList: %s", err)
+	}
+
+	want := []string{"192.0.2.1", "198.51.100.7", "203.0.113.9", "2001:db8::1", "192.0.2.50"}
+	if len(addrs) != len(want) {
+		t.Errorf("parseExitList found %d addresses, want %d", len(addrs), len(want))
+	}
+
+	for _, addr := range want {
+		if !addrs[netip.MustParseAddr(addr)] {
+			t.Errorf("parseExitList is missing %s", addr)
+		}
+	}
+}
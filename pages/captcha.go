@@ -0,0 +1,280 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	mrand "math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	. "github.com/patapancakes/tanuki/config"
+	. "github.com/patapancakes/tanuki/db"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	captchaAudience = "captcha"
+	captchaExpiry   = time.Minute * 10
+	captchaLength   = 5
+	captchaChars    = "ACDEFHJKLMNPQRTUVWXY2345679" // no lookalikes
+
+	captchaWidth  = 160
+	captchaHeight = 60
+)
+
+var (
+	errCaptchaMissing   = errors.New("please complete the captcha")
+	errCaptchaInvalid   = errors.New("the captcha has expired, please reload the page and try again")
+	errCaptchaIncorrect = errors.New("incorrect captcha, please reload the page and try again")
+
+	spentCaptchas tokenSet
+
+	captchaFace     font.Face
+	captchaFaceOnce sync.Once
+)
+
+// Captcha is a challenge issued with the post form, the answer is derived from
+// the token id with the session key so nothing has to be stored until it's used
+type Captcha struct {
+	Token    string
+	Question string // text alternative to the image
+}
+
+// needsCaptcha reports whether the configured captcha mode applies to a post
+func needsCaptcha(poster Poster, thread bool) bool {
+	if flood.Mode() == "captcha" {
+		return true
+	}
+
+	switch Config.Captcha {
+	case "threads":
+		return thread
+	case "replies":
+		return !thread
+	case "all":
+		return true
+	case "new":
+		return poster.LastPost.IsZero()
+	}
+
+	return false
+}
+
+func newCaptcha(identity string) (Captcha, error) {
+	key, err := os.ReadFile("data/session.key")
+	if err != nil {
+		return Captcha{}, fmt.Errorf("failed to read session signing key: %w", err)
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	claims := jwt.RegisteredClaims{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		Audience:  jwt.ClaimStrings{captchaAudience},
+		Subject:   identity,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(captchaExpiry)),
+	}
+
+	var captcha Captcha
+	captcha.Token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		return Captcha{}, fmt.Errorf("failed to sign captcha: %w", err)
+	}
+
+	if len(Config.CaptchaQuestions) != 0 {
+		captcha.Question = Config.CaptchaQuestions[captchaQuestion(key, claims.ID)].Question
+	}
+
+	return captcha, nil
+}
+
+// parseCaptcha validates a captcha token and returns its claims and the signing key
+func parseCaptcha(token string) (jwt.RegisteredClaims, []byte, error) {
+	key, err := os.ReadFile("data/session.key")
+	if err != nil {
+		return jwt.RegisteredClaims{}, nil, fmt.Errorf("failed to read session signing key: %w", err)
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err = jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (any, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(captchaAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return jwt.RegisteredClaims{}, nil, errCaptchaInvalid
+	}
+
+	return claims, key, nil
+}
+
+// checkCaptcha verifies a captcha answer, each token can only be tried once
+func checkCaptcha(token string, answer string, identity string) error {
+	answer = strings.Join(strings.Fields(answer), " ")
+	if token == "" || answer == "" {
+		return errCaptchaMissing
+	}
+
+	claims, key, err := parseCaptcha(token)
+	if err != nil {
+		return err
+	}
+	if claims.Subject != identity {
+		return errCaptchaInvalid
+	}
+
+	if !spentCaptchas.Spend(claims.ID, claims.ExpiresAt.Time) {
+		return errCaptchaInvalid
+	}
+
+	if strings.EqualFold(strings.ReplaceAll(answer, " ", ""), captchaAnswer(key, claims.ID)) {
+		return nil
+	}
+
+	if len(Config.CaptchaQuestions) != 0 {
+		for _, a := range Config.CaptchaQuestions[captchaQuestion(key, claims.ID)].Answers {
+			if strings.EqualFold(answer, strings.TrimSpace(a)) {
+				return nil
+			}
+		}
+	}
+
+	return errCaptchaIncorrect
+}
+
+func captchaMAC(key []byte, id string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte("captcha:" + id))
+
+	return h.Sum(nil)
+}
+
+func captchaAnswer(key []byte, id string) string {
+	mac := captchaMAC(key, id)
+
+	answer := make([]byte, captchaLength)
+	for i := range answer {
+		answer[i] = captchaChars[int(mac[i])%len(captchaChars)]
+	}
+
+	return string(answer)
+}
+
+func captchaQuestion(key []byte, id string) int {
+	mac := captchaMAC(key, id)
+
+	return int(mac[len(mac)-1]) % len(Config.CaptchaQuestions)
+}
+
+func CaptchaImage(w http.ResponseWriter, r *http.Request) {
+	claims, key, err := parseCaptcha(r.PathValue("token"))
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var b bytes.Buffer
+	err = png.Encode(&b, drawCaptcha(captchaAnswer(key, claims.ID)))
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to encode captcha: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(b.Bytes())
+}
+
+// drawCaptcha renders text with jittered glyphs, a wave distortion and noise
+func drawCaptcha(text string) image.Image {
+	captchaFaceOnce.Do(func() {
+		f, err := opentype.Parse(gobold.TTF)
+		if err != nil {
+			panic(err)
+		}
+
+		captchaFace, err = opentype.NewFace(f, &opentype.FaceOptions{Size: 32, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			panic(err)
+		}
+	})
+
+	bounds := image.Rect(0, 0, captchaWidth, captchaHeight)
+
+	// glyphs
+	glyphs := image.NewAlpha(bounds)
+	d := font.Drawer{Dst: glyphs, Src: image.Opaque, Face: captchaFace}
+	for i, c := range text {
+		d.Dot = fixed.P(10+i*28+mrand.IntN(6), 42+mrand.IntN(12)-6)
+		d.DrawString(string(c))
+	}
+
+	// warp the glyphs onto the background
+	img := image.NewRGBA(bounds)
+	ink := color.RGBA{uint8(mrand.IntN(96)), uint8(mrand.IntN(96)), uint8(mrand.IntN(96)), 255}
+
+	ampX, ampY := 1.5+mrand.Float64()*2, 1.5+mrand.Float64()*2
+	phaseX, phaseY := mrand.Float64()*math.Pi*2, mrand.Float64()*math.Pi*2
+	for y := range captchaHeight {
+		for x := range captchaWidth {
+			sx := x + int(ampX*math.Sin(float64(y)/9+phaseX))
+			sy := y + int(ampY*math.Sin(float64(x)/19+phaseY))
+
+			if glyphs.AlphaAt(sx, sy).A > 128 {
+				img.SetRGBA(x, y, ink)
+				continue
+			}
+
+			shade := uint8(224 + mrand.IntN(32))
+			img.SetRGBA(x, y, color.RGBA{shade, shade, shade, 255})
+		}
+	}
+
+	// noise lines
+	for range 4 {
+		x0, y0 := 0, mrand.IntN(captchaHeight)
+		x1, y1 := captchaWidth-1, mrand.IntN(captchaHeight)
+		steps := captchaWidth * 2
+		for i := range steps {
+			x := x0 + (x1-x0)*i/steps
+			y := y0 + (y1-y0)*i/steps
+			img.SetRGBA(x, y, ink)
+		}
+	}
+
+	return img
+}
@@ -21,13 +21,15 @@ package pages
 import (
 	"embed"
 	"errors"
+	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
 	"math/rand/v2"
 	"net/http"
-	"net/netip"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	. "github.com/patapancakes/tanuki/config"
@@ -44,10 +46,26 @@ var (
 		"max":     func(a, b int) int { return max(a, b) },
 		"config":  func() ConfigFile { return Config },
 		"rand":    rand.IntN,
+		"accept":  func() string { return accept },
+		"media":   mediaURL,
+
+		"identity": shortIdentity,
+
+		"banDurations": func() []banDuration { return banDurations },
 	}
 
-	posts   db.PostDB
-	posters db.PosterDB
+	accept string
+
+	posts     db.PostDB
+	posters   db.PosterDB
+	rangeBans db.RangeBanDB
+	appeals   db.AppealDB
+	reports   db.ReportDB
+	filters   db.FilterDB
+	tokens    db.TokenDB
+	accounts  db.AccountDB
+	audit     db.AuditDB
+	media     db.MediaStore
 
 	//go:embed templates
 	templates      embed.FS
@@ -61,6 +79,37 @@ var (
 	errInvalidSessionSubject = errors.New("invalid session subject")
 )
 
+type banDuration struct {
+	Label string
+	Value time.Duration
+}
+
+var banDurations = []banDuration{
+	{"1 Hour", time.Hour},
+	{"1 Day", time.Hour * 24},
+	{"3 Days", time.Hour * 24 * 3},
+	{"1 Week", time.Hour * 24 * 7},
+	{"30 Days", time.Hour * 24 * 30},
+}
+
+func banUntil(expiry time.Time) string {
+	if expiry.IsZero() {
+		return "forever"
+	}
+
+	return expiry.Format(time.DateTime)
+}
+
+type Staff struct {
+	Name string
+	Role db.Role
+}
+
+type sessionClaims struct {
+	Account string `json:"account"`
+	jwt.RegisteredClaims
+}
+
 func Init() error {
 	var err error
 
@@ -130,67 +179,436 @@ func Init() error {
 		return err
 	}
 
+	// uploads
+	accept = acceptTypes()
+
+	// media
+	switch Config.MediaStore {
+	case "", "local":
+		media = db.NewMediaLocal("data")
+	case "s3":
+		media, err = db.NewMediaS3(Config.S3Endpoint, Config.S3Region, Config.S3Bucket, Config.S3AccessKey, Config.S3SecretKey, Config.S3PublicURL)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown media store \"%s\"", Config.MediaStore)
+	}
+
+	// accounts
+	accountsT, err = template.New("accounts.html").Funcs(funcs).ParseFS(TemplatesFS, "accounts.html")
+	if err != nil {
+		return err
+	}
+
+	accountsT, err = accountsT.ParseFS(TemplatesFS, "include/*.html")
+	if err != nil {
+		return err
+	}
+
+	// audit
+	auditT, err = template.New("audit.html").Funcs(funcs).ParseFS(TemplatesFS, "audit.html")
+	if err != nil {
+		return err
+	}
+
+	auditT, err = auditT.ParseFS(TemplatesFS, "include/*.html")
+	if err != nil {
+		return err
+	}
+
+	// banned
+	bannedT, err = template.New("banned.html").Funcs(funcs).ParseFS(TemplatesFS, "banned.html")
+	if err != nil {
+		return err
+	}
+
+	bannedT, err = bannedT.ParseFS(TemplatesFS, "include/*.html")
+	if err != nil {
+		return err
+	}
+
+	// appeals
+	appealsT, err = template.New("appeals.html").Funcs(funcs).ParseFS(TemplatesFS, "appeals.html")
+	if err != nil {
+		return err
+	}
+
+	appealsT, err = appealsT.ParseFS(TemplatesFS, "include/*.html")
+	if err != nil {
+		return err
+	}
+
+	// report
+	reportT, err = template.New("report.html").Funcs(funcs).ParseFS(TemplatesFS, "report.html")
+	if err != nil {
+		return err
+	}
+
+	reportT, err = reportT.ParseFS(TemplatesFS, "include/*.html")
+	if err != nil {
+		return err
+	}
+
+	// reports
+	reportsT, err = template.New("reports.html").Funcs(funcs).ParseFS(TemplatesFS, "reports.html")
+	if err != nil {
+		return err
+	}
+
+	reportsT, err = reportsT.ParseFS(TemplatesFS, "include/*.html")
+	if err != nil {
+		return err
+	}
+
+	// queue
+	queueT, err = template.New("queue.html").Funcs(funcs).ParseFS(TemplatesFS, "queue.html")
+	if err != nil {
+		return err
+	}
+
+	queueT, err = queueT.ParseFS(TemplatesFS, "include/*.html")
+	if err != nil {
+		return err
+	}
+
+	// pending
+	pendingT, err = template.New("pending.html").Funcs(funcs).ParseFS(TemplatesFS, "pending.html")
+	if err != nil {
+		return err
+	}
+
+	pendingT, err = pendingT.ParseFS(TemplatesFS, "include/*.html")
+	if err != nil {
+		return err
+	}
+
+	// filters
+	filtersT, err = template.New("filters.html").Funcs(funcs).ParseFS(TemplatesFS, "filters.html")
+	if err != nil {
+		return err
+	}
+
+	filtersT, err = filtersT.ParseFS(TemplatesFS, "include/*.html")
+	if err != nil {
+		return err
+	}
+
+	// tokens
+	tokensT, err = template.New("tokens.html").Funcs(funcs).ParseFS(TemplatesFS, "tokens.html")
+	if err != nil {
+		return err
+	}
+
+	tokensT, err = tokensT.ParseFS(TemplatesFS, "include/*.html")
+	if err != nil {
+		return err
+	}
+
+	// feeds
+	feedBodyT, err = template.New("feedbody.html").Funcs(funcs).ParseFS(TemplatesFS, "feedbody.html")
+	if err != nil {
+		return err
+	}
+
+	// proxies
+	err = parseTrustedProxies()
+	if err != nil {
+		return err
+	}
+
+	// identities
+	switch Config.IdentityMode {
+	case "", "ip":
+	case "hmac":
+		err = loadIdentityKeys()
+		if err != nil {
+			return fmt.Errorf("failed to load identity keys: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown identity mode \"%s\"", Config.IdentityMode)
+	}
+
+	// moderation
+	switch Config.Moderation {
+	case "", "threads", "all", "new":
+	default:
+		return fmt.Errorf("unknown moderation mode \"%s\"", Config.Moderation)
+	}
+
+	// captcha
+	switch Config.Captcha {
+	case "", "threads", "replies", "all", "new":
+	default:
+		return fmt.Errorf("unknown captcha mode \"%s\"", Config.Captcha)
+	}
+
+	// flood protection
+	switch Config.FloodMode {
+	case "", "captcha", "threads", "staff":
+	default:
+		return fmt.Errorf("unknown flood mode \"%s\"", Config.FloodMode)
+	}
+
+	// blocklists
+	for _, list := range Config.Blocklists {
+		switch list.Action {
+		case "block", "captcha", "hold":
+		default:
+			return fmt.Errorf("unknown action \"%s\" for blocklist \"%s\"", list.Action, list.Zone)
+		}
+	}
+
+	if Config.TorExitList != "" {
+		switch Config.TorExitAction {
+		case "block", "captcha", "hold":
+		default:
+			return fmt.Errorf("unknown tor exit action \"%s\"", Config.TorExitAction)
+		}
+	}
+
+	resolver = newResolver(Config.BlocklistServer)
+
 	// database
-	posts = db.NewPostJSON("data/posts.json")
+	posts = db.NewPostJSON("data/posts.json", media)
 	posters = db.NewPosterJSON("data/posters.json")
+	rangeBans = db.NewRangeBanJSON("data/rangebans.json")
+	appeals = db.NewAppealJSON("data/appeals.json")
+	reports = db.NewReportJSON("data/reports.json")
+	filters = db.NewFilterJSON("data/filters.json")
+	tokens = db.NewTokenJSON("data/tokens.json")
+	accounts = db.NewAccountJSON("data/accounts.json")
+	audit = db.NewAuditJSON("data/audit.json")
+
+	// accounts
+	if Config.AdminPassword != "" {
+		all, err := accounts.GetAll()
+		if err != nil {
+			return err
+		}
+
+		if len(all) == 0 {
+			err = AddAccount("admin", db.RoleAdmin, Config.AdminPassword)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("created account \"admin\" from adminPassword, it can now be removed from the config file")
+		}
+	}
 
 	return nil
 }
 
 func deriveIdentity(r *http.Request) (string, error) {
-	// get ip
-	addrport, err := netip.ParseAddrPort(r.RemoteAddr)
+	network, err := clientNetwork(r)
 	if err != nil {
 		return "", err
 	}
 
-	ip := addrport.Addr()
-	if addrport.Addr().IsLoopback() && r.Header.Get("X-Forwarded-For") != "" {
-		ip, err = netip.ParseAddr(r.Header.Get("X-Forwarded-For"))
+	if Config.IdentityMode == "hmac" {
+		return hashIdentity(identityKeys[0], network), nil
+	}
+
+	return network, nil
+}
+
+// isBanned reports whether the request comes from a banned poster or address range
+func isBanned(r *http.Request, poster db.Poster) (bool, error) {
+	if poster.IsBanned() {
+		return true, nil
+	}
+
+	addr, err := clientAddr(r)
+	if err != nil {
+		return false, err
+	}
+
+	_, _, err = rangeBans.Match(addr)
+	if err != nil {
+		if err == db.ErrUnknownRange {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PostForm holds what the post form needs beyond the config
+type PostForm struct {
+	Parent      string
+	Captcha     Captcha
+	ProofOfWork bool
+}
+
+// newPostForm prepares the post form for a new thread or a reply to parent,
+// issuing a captcha if the poster has to solve one
+func newPostForm(r *http.Request, staff Staff, parent string) (PostForm, error) {
+	form := PostForm{Parent: parent}
+	if staff.Name != "" {
+		return form, nil
+	}
+
+	form.ProofOfWork = Config.ProofOfWork
+
+	identity, err := deriveIdentity(r)
+	if err != nil {
+		return form, err
+	}
+
+	poster, err := getPoster(r, identity)
+	if err != nil && err != db.ErrUnknownPoster {
+		return form, err
+	}
+
+	// blocklists are only queried when posting, so the form can't know whether the poster is listed
+	if needsCaptcha(poster, parent == "") || blocklistCaptcha() {
+		form.Captcha, err = newCaptcha(identity)
 		if err != nil {
-			return "", err
+			return form, err
+		}
+	}
+
+	return form, nil
+}
+
+// isVisible reports whether a post should be shown, staff can still see deleted and pending posts
+// and shadow banned posters can still see their own posts
+func isVisible(post db.Post, staff Staff, identity string) bool {
+	if staff.Name != "" {
+		return true
+	}
+
+	if post.IsDeleted() || post.Pending {
+		return false
+	}
+
+	return !post.Shadow || (identity != "" && post.Poster == identity)
+}
+
+// redact clears state the viewer shouldn't learn about, so shadow banned posters can't tell
+func redact(post db.Post, staff Staff) db.Post {
+	if staff.Name == "" {
+		post.Shadow = false
+
+		if post.IsImageDeleted() {
+			post.Image = false
+			post.Animated = false
+			post.AnimatedThumb = false
+			post.Spoiler = false
+			post.ImageAlt = ""
+			post.ImageDeleted = time.Time{}
 		}
 	}
-	if ip.Is6() && !ip.Is4In6() {
-		ip = netip.PrefixFrom(ip, 64).Masked().Addr()
+
+	return post
+}
+
+// filterPosts drops the posts and replies the viewer can't see
+func filterPosts(all db.PostData, staff Staff, identity string) db.PostData {
+	var visible db.PostData
+	for _, post := range all {
+		if !isVisible(post, staff, identity) {
+			continue
+		}
+
+		post = redact(post, staff)
+		post.Replies = filterPosts(post.Replies, staff, identity)
+
+		visible = append(visible, post)
 	}
 
-	return ip.String(), nil
+	return visible
 }
 
-func checkAuth(r *http.Request) error {
+func checkAuth(r *http.Request) (Staff, error) {
 	session, err := r.Cookie("session")
 	if err != nil {
-		return err
+		return Staff{}, err
 	}
 
-	token, err := jwt.Parse(session.Value, func(token *jwt.Token) (any, error) {
+	var claims sessionClaims
+	token, err := jwt.ParseWithClaims(session.Value, &claims, func(token *jwt.Token) (any, error) {
 		return os.ReadFile("data/session.key")
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
-		return err
+		return Staff{}, err
 	}
 	if !token.Valid {
-		return errInvalidSession
+		return Staff{}, errInvalidSession
 	}
 
 	identity, err := deriveIdentity(r)
 	if err != nil {
-		return err
+		return Staff{}, err
 	}
 
-	subject, err := token.Claims.GetSubject()
-	if err != nil {
-		return err
+	if claims.Subject != identity {
+		return Staff{}, errInvalidSessionSubject
 	}
-	if subject != identity {
-		return errInvalidSessionSubject
+
+	account, err := accounts.Get(claims.Account)
+	if err != nil {
+		if err == db.ErrUnknownAccount {
+			return Staff{}, errInvalidSession
+		}
+
+		return Staff{}, err
 	}
 
-	return nil
+	return Staff{Name: claims.Account, Role: account.Role}, nil
 }
 
 func writeLog(r *http.Request, text string) {
 	id, _ := deriveIdentity(r)
 	log.Printf("[%s] %s: %s", id, r.URL.Path, text)
 }
+
+func writeAudit(staff Staff, entry db.AuditEntry) {
+	entry.Time = time.Now()
+	entry.Actor = staff.Name
+
+	// the poster is recorded once, not in snapshots that would outlive PurgePosterData
+	if entry.Snapshot != nil {
+		snapshot := entry.Snapshot.WithoutPosters()
+		entry.Snapshot = &snapshot
+	}
+
+	err := audit.Add(entry)
+	if err != nil {
+		log.Printf("failed to write audit entry: %s", err)
+	}
+}
+
+// tokenSet remembers spent single-use tokens until they expire
+type tokenSet struct {
+	mtx    sync.Mutex
+	tokens map[string]time.Time
+}
+
+// Spend marks a token as used, reporting false if it already was
+func (s *tokenSet) Spend(id string, expiry time.Time) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.tokens == nil {
+		s.tokens = make(map[string]time.Time)
+	}
+
+	now := time.Now()
+	for token, until := range s.tokens {
+		if until.Before(now) {
+			delete(s.tokens, token)
+		}
+	}
+
+	if _, ok := s.tokens[id]; ok {
+		return false
+	}
+
+	s.tokens[id] = expiry
+
+	return true
+}
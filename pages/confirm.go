@@ -27,6 +27,8 @@ import (
 )
 
 type ConfirmData struct {
+	Staff Staff
+
 	Action  string
 	Referer string
 
@@ -37,20 +39,38 @@ var confirmT *template.Template
 
 func Confirm(w http.ResponseWriter, r *http.Request) {
 	var cd ConfirmData
+	var err error
 
-	err := checkAuth(r)
+	cd.Staff, err = checkAuth(r)
 	if err != nil {
 		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
 		return
 	}
 
+	cd.Action = r.PathValue("action")
+
+	switch cd.Action {
+	case "delete", "undelete":
+		if !cd.Staff.Role.CanDelete() {
+			writeError(w, r, "insufficient permissions", http.StatusForbidden)
+			return
+		}
+	case "ban":
+		if !cd.Staff.Role.CanBan() {
+			writeError(w, r, "insufficient permissions", http.StatusForbidden)
+			return
+		}
+	default:
+		writeError(w, r, "unknown action", http.StatusBadRequest)
+		return
+	}
+
 	cd.Post, err = posts.Get(r.PathValue("id"))
 	if err != nil {
 		writeError(w, r, fmt.Sprintf("failed to fetch post: %s", err), http.StatusInternalServerError)
 		return
 	}
 
-	cd.Action = r.PathValue("action")
 	cd.Referer = r.Referer()
 
 	err = confirmT.Execute(w, cd)
@@ -0,0 +1,430 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	. "github.com/patapancakes/tanuki/config"
+	. "github.com/patapancakes/tanuki/db"
+)
+
+const (
+	feedSize      = 20 // threads in the board feeds
+	feedTitleSize = 60 // characters of the body used as a title for posts without a subject
+)
+
+var feedBodyT *template.Template
+
+// feed is a board or thread feed before it's encoded as Atom or RSS
+type feed struct {
+	Title       string
+	Description string
+	Link        string // the page the feed follows
+	Self        string
+	Updated     time.Time
+	Entries     []feedEntry
+}
+
+type feedEntry struct {
+	ID        string
+	Title     string
+	Link      string
+	Author    string
+	Posted    time.Time
+	Content   string // rendered html
+	Thumb     string
+	ThumbType string
+}
+
+// feedPost is the data feedbody.html renders
+type feedPost struct {
+	Post     Post
+	FullURL  string
+	ThumbURL string // the spoiler image for spoilered posts
+	Lines    []string
+}
+
+// atomFeed follows RFC 4287
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Author    atomAuthor `xml:"author"`
+	Links     []atomLink `xml:"link"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// rssFeed follows RSS 2.0
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          atomLink  `xml:"http://www.w3.org/2005/Atom link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Text        string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// siteURL returns the public address of the board, set siteURL when running behind a proxy
+func siteURL(r *http.Request) string {
+	if Config.SiteURL != "" {
+		return strings.TrimSuffix(Config.SiteURL, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+// absURL resolves a link that may be relative to the board
+func absURL(base string, link string) string {
+	if strings.HasPrefix(link, "/") && !strings.HasPrefix(link, "//") {
+		return base + link
+	}
+
+	return link
+}
+
+// feedTitle names a post by its subject, or the start of its body
+func feedTitle(post Post) string {
+	if post.Subject != "" {
+		return post.Subject
+	}
+
+	title := strings.Join(strings.Fields(post.Body), " ")
+	if title == "" {
+		return fmt.Sprintf("Post %s", post.ID())
+	}
+
+	if utf8.RuneCountInString(title) > feedTitleSize {
+		title = string([]rune(title)[:feedTitleSize]) + "…"
+	}
+
+	return title
+}
+
+func newFeedEntry(base string, post Post) (feedEntry, error) {
+	entry := feedEntry{
+		Title:  feedTitle(post),
+		Link:   fmt.Sprintf("%s/thread/%s", base, post.ID()),
+		Author: post.Name,
+		Posted: post.Posted,
+	}
+
+	if !post.IsThread() {
+		entry.Link = fmt.Sprintf("%s/thread/%s#post_%s", base, post.Parent, post.ID())
+	}
+
+	entry.ID = entry.Link
+
+	if entry.Author == "" {
+		entry.Author = "Anonymous"
+	}
+	if post.IsStaff() && post.Name == "" {
+		entry.Author = post.Staff
+		if entry.Author == "" {
+			entry.Author = "admin"
+		}
+	}
+
+	fp := feedPost{Post: post}
+	if post.Body != "" {
+		fp.Lines = strings.Split(post.Body, "\n")
+	}
+
+	if post.Image {
+		fp.FullURL = absURL(base, mediaURL(post, post.FullPath()))
+		fp.ThumbURL = absURL(base, "/assets/spoiler.png")
+
+		// spoilered thumbnails stay out of enclosures, readers would show them straight away
+		if !post.Spoiler {
+			fp.ThumbURL = absURL(base, mediaURL(post, post.ThumbPath()))
+			entry.Thumb = fp.ThumbURL
+			entry.ThumbType = mime.TypeByExtension(path.Ext(post.ThumbPath()))
+		}
+	}
+
+	var content strings.Builder
+	err := feedBodyT.Execute(&content, fp)
+	if err != nil {
+		return feedEntry{}, err
+	}
+
+	entry.Content = strings.TrimSpace(content.String())
+
+	return entry, nil
+}
+
+func writeAtom(w http.ResponseWriter, r *http.Request, f feed) {
+	doc := atomFeed{
+		ID:       f.Self,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		Updated:  f.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.Self},
+			{Rel: "alternate", Type: "text/html", Href: f.Link},
+		},
+	}
+
+	for _, entry := range f.Entries {
+		ae := atomEntry{
+			ID:        entry.ID,
+			Title:     entry.Title,
+			Updated:   entry.Posted.UTC().Format(time.RFC3339),
+			Published: entry.Posted.UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: entry.Author},
+			Links:     []atomLink{{Rel: "alternate", Type: "text/html", Href: entry.Link}},
+			Content:   atomText{Type: "html", Text: entry.Content},
+		}
+
+		if entry.Thumb != "" {
+			ae.Links = append(ae.Links, atomLink{Rel: "enclosure", Type: entry.ThumbType, Href: entry.Thumb})
+		}
+
+		doc.Entries = append(doc.Entries, ae)
+	}
+
+	writeFeed(w, r, "application/atom+xml; charset=utf-8", doc, f.Updated)
+}
+
+func writeRSS(w http.ResponseWriter, r *http.Request, f feed) {
+	doc := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Description,
+			LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+			Self:          atomLink{Rel: "self", Type: "application/rss+xml", Href: f.Self},
+		},
+	}
+
+	for _, entry := range f.Entries {
+		item := rssItem{
+			Title:       entry.Title,
+			Link:        entry.Link,
+			Description: entry.Content,
+			GUID:        rssGUID{IsPermaLink: true, Text: entry.ID},
+			PubDate:     entry.Posted.UTC().Format(time.RFC1123Z),
+		}
+
+		// the thumbnail's size isn't known without fetching it, readers accept a length of 0
+		if entry.Thumb != "" {
+			item.Enclosure = &rssEnclosure{URL: entry.Thumb, Type: entry.ThumbType}
+		}
+
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+
+	writeFeed(w, r, "application/rss+xml; charset=utf-8", doc, f.Updated)
+}
+
+// writeFeed sends an encoded feed, answering conditional requests from its ETag and updated time
+func writeFeed(w http.ResponseWriter, r *http.Request, contentType string, doc any, updated time.Time) {
+	body, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to encode feed: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	body = append([]byte(xml.Header), body...)
+
+	sum := sha256.Sum256(body)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+
+	http.ServeContent(w, r, "", updated, bytes.NewReader(body))
+}
+
+// boardFeed lists the newest threads, feeds are shared by every reader so only public posts are included
+func boardFeed(w http.ResponseWriter, r *http.Request, self string) (feed, bool) {
+	all, err := posts.GetAll()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch posts: %s", err), http.StatusInternalServerError)
+		return feed{}, false
+	}
+
+	threads := filterPosts(all, Staff{}, "")
+	slices.SortFunc(threads, func(a, b Post) int { return b.Posted.Compare(a.Posted) })
+	threads = threads[:min(feedSize, len(threads))]
+
+	base := siteURL(r)
+
+	f := feed{
+		Title:       Config.SiteName,
+		Description: fmt.Sprintf("New threads on %s", Config.SiteName),
+		Link:        base + "/",
+		Self:        base + self,
+		Updated:     time.Now(),
+	}
+
+	if len(threads) != 0 {
+		f.Updated = threads[0].Posted
+	}
+
+	for _, thread := range threads {
+		entry, err := newFeedEntry(base, thread)
+		if err != nil {
+			writeError(w, r, fmt.Sprintf("failed to render post: %s", err), http.StatusInternalServerError)
+			return feed{}, false
+		}
+
+		f.Entries = append(f.Entries, entry)
+	}
+
+	return f, true
+}
+
+func AtomFeed(w http.ResponseWriter, r *http.Request) {
+	f, ok := boardFeed(w, r, "/feed.atom")
+	if !ok {
+		return
+	}
+
+	writeAtom(w, r, f)
+}
+
+func RSSFeed(w http.ResponseWriter, r *http.Request) {
+	f, ok := boardFeed(w, r, "/feed.rss")
+	if !ok {
+		return
+	}
+
+	writeRSS(w, r, f)
+}
+
+// ThreadFeed lists a thread and its replies, newest first
+func ThreadFeed(w http.ResponseWriter, r *http.Request) {
+	thread, err := posts.Get(r.PathValue("id"))
+	if err != nil {
+		if err == ErrUnknownPost {
+			writeError(w, r, "thread not found", http.StatusNotFound)
+			return
+		}
+
+		writeError(w, r, fmt.Sprintf("failed to fetch post: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if !thread.IsThread() || !isVisible(thread, Staff{}, "") {
+		writeError(w, r, "thread not found", http.StatusNotFound)
+		return
+	}
+
+	thread = redact(thread, Staff{})
+	thread.Replies = filterPosts(thread.Replies, Staff{}, "")
+
+	base := siteURL(r)
+
+	f := feed{
+		Title:       fmt.Sprintf("%s - %s", feedTitle(thread), Config.SiteName),
+		Description: fmt.Sprintf("Replies to thread %s on %s", thread.ID(), Config.SiteName),
+		Link:        fmt.Sprintf("%s/thread/%s", base, thread.ID()),
+		Self:        fmt.Sprintf("%s/thread/%s/feed.atom", base, thread.ID()),
+		Updated:     thread.Posted,
+	}
+
+	for _, post := range append([]Post{thread}, thread.Replies...) {
+		entry, err := newFeedEntry(base, post)
+		if err != nil {
+			writeError(w, r, fmt.Sprintf("failed to render post: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		f.Entries = append(f.Entries, entry)
+		if post.Posted.After(f.Updated) {
+			f.Updated = post.Posted
+		}
+	}
+
+	slices.Reverse(f.Entries)
+
+	writeAtom(w, r, f)
+}
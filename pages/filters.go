@@ -0,0 +1,199 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	. "github.com/patapancakes/tanuki/config"
+	. "github.com/patapancakes/tanuki/db"
+)
+
+const maxPatternSize = 200
+
+type FiltersData struct {
+	Staff Staff
+
+	Filters FilterData
+	Actions []FilterAction
+}
+
+var filtersT *template.Template
+
+func Filters(w http.ResponseWriter, r *http.Request) {
+	var fd FiltersData
+	var err error
+
+	fd.Staff, err = checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !fd.Staff.Role.CanConfig() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	fd.Filters, err = filters.GetAll()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch filters: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	fd.Actions = FilterActions
+
+	err = filtersT.Execute(w, fd)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func AdminAddFilter(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanConfig() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	filter := Filter{
+		Pattern:     r.FormValue("pattern"),
+		Regexp:      r.FormValue("regexp") != "",
+		Action:      FilterAction(r.FormValue("action")),
+		Replacement: r.FormValue("replacement"),
+		Reason:      r.FormValue("reason"),
+		Created:     time.Now(),
+	}
+
+	if filter.Pattern == "" || !utf8.ValidString(filter.Pattern) || utf8.RuneCountInString(filter.Pattern) > maxPatternSize {
+		writeError(w, r, "invalid pattern", http.StatusBadRequest)
+		return
+	}
+	if !filter.Action.IsValid() {
+		writeError(w, r, "invalid action", http.StatusBadRequest)
+		return
+	}
+	if !utf8.ValidString(filter.Replacement) || utf8.RuneCountInString(filter.Replacement) > Config.MaxCommentSize {
+		writeError(w, r, "invalid replacement", http.StatusBadRequest)
+		return
+	}
+
+	_, err = filter.Compile()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("invalid pattern: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if filter.Action == FilterBan && r.FormValue("duration") != "" {
+		filter.BanDuration, err = time.ParseDuration(r.FormValue("duration"))
+		if err != nil || filter.BanDuration <= 0 {
+			writeError(w, r, "invalid ban duration", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = filters.Add(filter)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to insert filter: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/filters", http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("added %s filter \"%s\"", filter.Action, filter.Pattern))
+	writeAudit(staff, AuditEntry{Action: "add filter", Reason: fmt.Sprintf("%s (%s)", filter.Pattern, filter.Action)})
+}
+
+func AdminDeleteFilter(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanConfig() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to parse request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	patterns, ok := r.Form["pattern"]
+	if !ok {
+		writeError(w, r, "no filters specified", http.StatusBadRequest)
+		return
+	}
+
+	for _, pattern := range patterns {
+		err = filters.Delete(pattern)
+		if err != nil && err != ErrUnknownFilter {
+			writeError(w, r, fmt.Sprintf("failed to delete filter: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeAudit(staff, AuditEntry{Action: "delete filter", Reason: pattern})
+	}
+
+	http.Redirect(w, r, "/admin/filters", http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("deleted filter(s) \"%s\"", patterns))
+}
+
+// applyFilters runs every filter over the post's name, subject and body,
+// making replacements and returning the strictest filter that matched
+func applyFilters(post *Post) (Filter, bool, error) {
+	all, err := filters.GetAll()
+	if err != nil {
+		return Filter{}, false, err
+	}
+
+	var matched Filter
+	var found bool
+	for _, filter := range all {
+		for _, field := range []*string{&post.Name, &post.Subject, &post.Body} {
+			text, ok, err := filter.Apply(*field)
+			if err != nil {
+				return Filter{}, false, fmt.Errorf("filter \"%s\": %w", filter.Pattern, err)
+			}
+			if !ok {
+				continue
+			}
+
+			*field = text
+
+			if !found || filter.Action.Severity() > matched.Action.Severity() {
+				matched = filter
+				found = true
+			}
+		}
+	}
+
+	return matched, found, nil
+}
@@ -0,0 +1,91 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/patapancakes/tanuki/config"
+)
+
+// floodMonitor tracks post rates across every poster in a sliding window,
+// switching the board into a protected mode while they're abnormally high
+type floodMonitor struct {
+	mtx sync.Mutex
+
+	threads []time.Time
+	replies []time.Time
+	until   time.Time
+}
+
+var flood floodMonitor
+
+// Record notes a new post and reports why if it pushed the board into protected mode
+func (f *floodMonitor) Record(thread bool) (string, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	now := time.Now()
+	window := time.Second * time.Duration(Config.FloodWindow)
+
+	f.threads = prune(f.threads, now.Add(-window))
+	f.replies = prune(f.replies, now.Add(-window))
+
+	events, limit, kind := &f.replies, Config.FloodReplies, "replies"
+	if thread {
+		events, limit, kind = &f.threads, Config.FloodThreads, "threads"
+	}
+
+	*events = append(*events, now)
+	if limit <= 0 || len(*events) <= limit {
+		return "", false
+	}
+
+	// keep extending the cooldown while the flood goes on, but only report it once
+	active := now.Before(f.until)
+	f.until = now.Add(time.Minute * time.Duration(Config.FloodCooldown))
+	if active {
+		return "", false
+	}
+
+	return fmt.Sprintf("%d %s within %s, protected until %s", len(*events), kind, window, f.until.Format("2006-01-02 15:04:05")), true
+}
+
+// Mode returns the protected mode currently in effect, if any
+func (f *floodMonitor) Mode() string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if time.Now().After(f.until) {
+		return ""
+	}
+
+	return Config.FloodMode
+}
+
+// prune drops the times before since, which are kept in order
+func prune(times []time.Time, since time.Time) []time.Time {
+	for len(times) > 0 && times[0].Before(since) {
+		times = times[1:]
+	}
+
+	return times
+}
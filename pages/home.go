@@ -30,9 +30,10 @@ import (
 )
 
 type HomeData struct {
-	Admin bool
+	Staff Staff
 
 	Posts PostData
+	Form  PostForm
 
 	Page  int
 	Pages int
@@ -44,19 +45,15 @@ func Home(w http.ResponseWriter, r *http.Request) {
 	var hd HomeData
 	var err error
 
-	if Config.AdminPassword != "" {
-		err := checkAuth(r)
-		if err != nil {
-			if err == errInvalidSession {
-				http.Redirect(w, r, "/admin/logout", http.StatusSeeOther)
-				return
-			}
-			if err != http.ErrNoCookie {
-				writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
-				return
-			}
-		} else {
-			hd.Admin = true
+	hd.Staff, err = checkAuth(r)
+	if err != nil {
+		if err == errInvalidSession {
+			http.Redirect(w, r, "/admin/logout", http.StatusSeeOther)
+			return
+		}
+		if err != http.ErrNoCookie {
+			writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+			return
 		}
 	}
 
@@ -75,6 +72,14 @@ func Home(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	identity, err := deriveIdentity(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to derive identity: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	hd.Posts = filterPosts(hd.Posts, hd.Staff, identity)
+
 	hd.Pages = 1
 	if len(hd.Posts) > Config.MaxPostsPerPage {
 		hd.Pages = int(math.Ceil(float64(len(hd.Posts)) / float64(Config.MaxPostsPerPage)))
@@ -87,6 +92,12 @@ func Home(w http.ResponseWriter, r *http.Request) {
 	hd.Posts = hd.Posts[min((hd.Page-1)*Config.MaxPostsPerPage, len(hd.Posts)):]
 	hd.Posts = hd.Posts[:min(Config.MaxPostsPerPage, len(hd.Posts))]
 
+	hd.Form, err = newPostForm(r, hd.Staff, "")
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to prepare post form: %s", err), http.StatusInternalServerError)
+		return
+	}
+
 	err = homeT.Execute(w, hd)
 	if err != nil {
 		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
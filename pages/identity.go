@@ -0,0 +1,202 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+
+	. "github.com/patapancakes/tanuki/config"
+	"github.com/patapancakes/tanuki/db"
+)
+
+const (
+	identityKeyFile = "data/identity.key"
+	identityKeySize = 32
+	identityHashLen = 32 // hex characters kept of each hmac
+	identityShown   = 12 // hex characters shown to staff
+)
+
+// identityKeys holds the current hmac key followed by the one it replaced
+var identityKeys [][]byte
+
+// loadIdentityKeys reads the hmac keys, creating the first one if needed
+func loadIdentityKeys() error {
+	data, err := os.ReadFile(identityKeyFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		return RotateIdentityKey()
+	}
+
+	if len(data) == 0 || len(data)%identityKeySize != 0 {
+		return errors.New("invalid identity key file")
+	}
+
+	identityKeys = nil
+	for len(data) > 0 {
+		identityKeys = append(identityKeys, data[:identityKeySize])
+		data = data[identityKeySize:]
+	}
+
+	return nil
+}
+
+// RotateIdentityKey replaces the hmac key, the old key is kept only so bans can
+// follow posters over to their new identity and is dropped at the next rotation
+func RotateIdentityKey() error {
+	key := make([]byte, identityKeySize)
+	rand.Read(key)
+
+	keys := [][]byte{key}
+	if len(identityKeys) > 0 {
+		keys = append(keys, identityKeys[0])
+	}
+
+	var data []byte
+	for _, k := range keys {
+		data = append(data, k...)
+	}
+
+	err := os.WriteFile(identityKeyFile, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	identityKeys = keys
+
+	return nil
+}
+
+// clientNetwork returns the address identities are derived from, grouping IPv6 clients by /64
+func clientNetwork(r *http.Request) (string, error) {
+	ip, err := clientAddr(r)
+	if err != nil {
+		return "", err
+	}
+
+	if ip.Is6() && !ip.Is4In6() {
+		ip = netip.PrefixFrom(ip, 64).Masked().Addr()
+	}
+
+	return ip.String(), nil
+}
+
+func hashIdentity(key []byte, network string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(network))
+
+	return hex.EncodeToString(h.Sum(nil))[:identityHashLen]
+}
+
+// previousIdentities returns the identities a poster may have had before the key
+// was rotated or hmac identities were turned on
+func previousIdentities(r *http.Request) ([]string, error) {
+	if Config.IdentityMode != "hmac" {
+		return nil, nil
+	}
+
+	network, err := clientNetwork(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{network}
+	for _, key := range identityKeys[1:] {
+		ids = append(ids, hashIdentity(key, network))
+	}
+
+	return ids, nil
+}
+
+// getPoster looks up the requesting poster, moving over a ban issued to one of its previous identities,
+// unknown posters come back empty
+func getPoster(r *http.Request, identity string) (db.Poster, error) {
+	poster, err := posters.Get(identity)
+	if err != nil && err != db.ErrUnknownPoster {
+		return poster, err
+	}
+	if !poster.BanTime.IsZero() {
+		return poster, nil
+	}
+
+	ids, err := previousIdentities(r)
+	if err != nil {
+		return poster, err
+	}
+
+	for _, id := range ids {
+		old, err := posters.Get(id)
+		if err != nil {
+			if err == db.ErrUnknownPoster {
+				continue
+			}
+
+			return poster, err
+		}
+		if old.BanTime.IsZero() {
+			continue
+		}
+
+		poster.BanTime = old.BanTime
+		poster.BanReason = old.BanReason
+		poster.BanExpiry = old.BanExpiry
+		poster.BanPost = old.BanPost
+		poster.BanShadow = old.BanShadow
+
+		err = posters.Add(identity, poster)
+		if err != nil {
+			return poster, fmt.Errorf("failed to move ban: %w", err)
+		}
+
+		old.Unban()
+
+		err = posters.Add(id, old)
+		if err != nil {
+			return poster, fmt.Errorf("failed to move ban: %w", err)
+		}
+
+		break
+	}
+
+	return poster, nil
+}
+
+// shortIdentity truncates hmac identities for display
+func shortIdentity(id string) string {
+	if len(id) != identityHashLen {
+		return id
+	}
+
+	_, err := hex.DecodeString(id)
+	if err != nil {
+		return id
+	}
+
+	return id[:identityShown]
+}
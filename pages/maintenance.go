@@ -0,0 +1,173 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	. "github.com/patapancakes/tanuki/config"
+	"github.com/patapancakes/tanuki/db"
+)
+
+// CollectGarbage deletes image files that no post references and reports
+// posts whose image files are missing
+func CollectGarbage() error {
+	report, err := db.CollectMedia(posts, media, time.Hour)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range report.Removed {
+		log.Printf("removed orphaned file \"%s\"", name)
+	}
+	for _, name := range report.Missing {
+		log.Printf("missing file \"%s\"", name)
+	}
+
+	log.Printf("media collection removed %d orphaned file(s), %d file(s) missing", len(report.Removed), len(report.Missing))
+
+	return nil
+}
+
+// ExpireBans lifts bans whose duration has passed
+func ExpireBans() error {
+	expired, err := posters.ExpireBans()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range expired {
+		log.Printf("ban on poster with id \"%s\" expired", id)
+		writeAudit(Staff{}, db.AuditEntry{Action: "unban", Poster: id, Reason: "ban expired"})
+	}
+
+	expired, err = rangeBans.ExpireBans()
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range expired {
+		log.Printf("ban on range \"%s\" expired", prefix)
+		writeAudit(Staff{}, db.AuditEntry{Action: "unban range", Poster: prefix, Reason: "ban expired"})
+	}
+
+	return nil
+}
+
+// PurgeDeleted permanently removes posts deleted longer ago than the retention period
+func PurgeDeleted() error {
+	purged, err := posts.Purge(time.Now().AddDate(0, 0, -Config.DeleteRetention))
+	if err != nil {
+		return err
+	}
+
+	for _, id := range purged {
+		log.Printf("purged deleted post with id \"%s\"", id)
+	}
+
+	return nil
+}
+
+// RefreshTorExits downloads the Tor exit list, replacing the local file only if the download looks sane
+func RefreshTorExits() error {
+	client := http.Client{Timeout: time.Minute}
+
+	resp, err := client.Get(Config.TorExitURL)
+	if err != nil {
+		return fmt.Errorf("failed to download exit list: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	list, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to download exit list: %w", err)
+	}
+
+	addrs, err := parseExitList(bytes.NewReader(list))
+	if err != nil {
+		return fmt.Errorf("failed to parse exit list: %w", err)
+	}
+	if len(addrs) == 0 {
+		return errors.New("exit list is empty")
+	}
+
+	// write then rename so readers never see a partial file
+	err = os.WriteFile(Config.TorExitList+".tmp", list, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write exit list: %w", err)
+	}
+
+	err = os.Rename(Config.TorExitList+".tmp", Config.TorExitList)
+	if err != nil {
+		return fmt.Errorf("failed to replace exit list: %w", err)
+	}
+
+	log.Printf("refreshed tor exit list with %d address(es)", len(addrs))
+
+	return nil
+}
+
+// PurgePosterData forgets who made posts and audit entries older than the poster retention period,
+// drops inactive posters and expires old reports and resolved appeals, which record who filed them
+func PurgePosterData() error {
+	before := time.Now().AddDate(0, 0, -Config.PosterRetention)
+
+	forgotten, err := posts.ForgetPosters(before)
+	if err != nil {
+		return err
+	}
+
+	pruned, err := posters.Prune(before)
+	if err != nil {
+		return err
+	}
+
+	entries, err := audit.Forget(before)
+	if err != nil {
+		return err
+	}
+
+	expired, err := reports.Forget(before)
+	if err != nil {
+		return err
+	}
+
+	resolved, err := appeals.Forget(before)
+	if err != nil {
+		return err
+	}
+
+	if forgotten > 0 || len(pruned) > 0 || entries > 0 || expired > 0 || resolved > 0 {
+		log.Printf("forgot the poster of %d post(s) and %d audit entry(s), removed %d inactive poster(s), %d report(s) and %d resolved appeal(s)", forgotten, entries, len(pruned), expired, resolved)
+	}
+
+	return nil
+}
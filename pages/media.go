@@ -0,0 +1,114 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	. "github.com/patapancakes/tanuki/db"
+)
+
+func Media(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+
+	public, err := checkMedia(r, name)
+	if err != nil {
+		if err == ErrUnknownPost {
+			writeError(w, r, "file not found", http.StatusNotFound)
+			return
+		}
+
+		writeError(w, r, fmt.Sprintf("failed to fetch post: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	f, file, err := media.Get(name)
+	if err != nil {
+		if err == ErrUnknownMedia {
+			writeError(w, r, "file not found", http.StatusNotFound)
+			return
+		}
+
+		writeError(w, r, fmt.Sprintf("failed to fetch file: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	defer f.Close()
+
+	// files can be hidden again by deletion, so caches have to revalidate eventually
+	if public {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+
+	http.ServeContent(w, r, name, file.Modified, f)
+}
+
+// mediaURL links to a post's media, only straight to the media store when everyone can see
+// the post, so checkMedia still guards the media of posts hidden from some
+func mediaURL(post Post, name string) string {
+	if post.IsDeleted() || post.Pending || post.Shadow || post.IsImageDeleted() {
+		return "/" + name
+	}
+
+	return media.URL(name)
+}
+
+// checkMedia returns ErrUnknownPost if the requester can't see the post a media file belongs to,
+// and whether everyone else can see it too
+func checkMedia(r *http.Request, name string) (bool, error) {
+	post, err := posts.Get(strings.TrimSuffix(path.Base(name), path.Ext(name)))
+	if err != nil {
+		return false, err
+	}
+
+	// replies are hidden along with their thread
+	parent := post
+	if !post.IsThread() {
+		parent, err = posts.Get(post.Parent)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	visible := func(staff Staff, identity string) bool {
+		if staff.Name == "" && post.IsImageDeleted() {
+			return false
+		}
+
+		return isVisible(post, staff, identity) && isVisible(parent, staff, identity)
+	}
+
+	staff, _ := checkAuth(r)
+
+	identity, err := deriveIdentity(r)
+	if err != nil {
+		return false, fmt.Errorf("failed to derive identity: %w", err)
+	}
+
+	if !visible(staff, identity) {
+		return false, ErrUnknownPost
+	}
+
+	return visible(Staff{}, ""), nil
+}
@@ -0,0 +1,57 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/patapancakes/tanuki/db"
+)
+
+func TestMediaURL(t *testing.T) {
+	defer func(m MediaStore) { media = m }(media)
+
+	var err error
+	media, err = NewMediaS3("http://s3.example", "", "bucket", "access", "secret", "https://cdn.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posted := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		post Post
+		want string
+	}{
+		{"visible", Post{Posted: posted, Image: true}, "https://cdn.example/"},
+		{"deleted", Post{Posted: posted, Image: true, Deleted: posted}, "/"},
+		{"pending", Post{Posted: posted, Image: true, Pending: true}, "/"},
+		{"shadow", Post{Posted: posted, Image: true, Shadow: true}, "/"},
+		{"image deleted", Post{Posted: posted, Image: true, ImageDeleted: posted}, "/"},
+	}
+
+	for _, tt := range tests {
+		name := tt.post.ThumbPath()
+		if got := mediaURL(tt.post, name); got != tt.want+name {
+			t.Errorf("%s: mediaURL = %q, want %q", tt.name, got, tt.want+name)
+		}
+	}
+}
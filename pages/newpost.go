@@ -19,9 +19,15 @@
 package pages
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"image"
+	"image/gif"
+	"io"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -29,134 +35,518 @@ import (
 	. "github.com/patapancakes/tanuki/config"
 	. "github.com/patapancakes/tanuki/db"
 
-	_ "image/gif"
-
+	_ "github.com/gen2brain/avif"
 	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	maxImagePixels     = 40000000  // width times height
+	maxAnimationPixels = 200000000 // width times height times frames
 )
 
+// imageType is an upload mime type with a header its decoder sniffs for
+type imageType struct {
+	mime  string
+	magic string
+}
+
+var knownImageTypes = []imageType{
+	{"image/bmp", "BM\x00\x00\x00\x00\x00\x00\x00\x00"},
+	{"image/png", "\x89PNG\r\n\x1a\n"},
+	{"image/jpeg", "\xff\xd8"},
+	{"image/gif", "GIF89a"},
+	{"image/webp", "RIFF\x00\x00\x00\x00WEBPVP8"},
+	{"image/avif", "\x00\x00\x00\x1cftypavif"},
+}
+
+// imageTypes maps the name of every registered decoder to its mime type
+var imageTypes = registeredImageTypes()
+
+// registeredImageTypes sniffs each known header to find which formats
+// image.DecodeConfig can recognise, and the names their decoders register
+func registeredImageTypes() map[string]string {
+	types := make(map[string]string)
+	for _, t := range knownImageTypes {
+		_, format, err := image.DecodeConfig(strings.NewReader(t.magic))
+		if err == image.ErrFormat {
+			continue
+		}
+
+		types[format] = t.mime
+	}
+
+	return types
+}
+
+// acceptTypes lists the mime types of every image format with a registered decoder
+func acceptTypes() string {
+	return strings.Join(slices.Sorted(maps.Values(imageTypes)), ", ")
+}
+
+// isImageType reports whether format, as returned by image.DecodeConfig, has a known mime type
+func isImageType(format string) bool {
+	_, ok := imageTypes[format]
+
+	return ok
+}
+
+// postRequest is a submitted post, from the post form or the api
+type postRequest struct {
+	Parent  string
+	Name    string
+	Subject string
+	Body    string
+
+	Image    io.ReadSeeker // nil if no image was uploaded
+	Spoiler  bool
+	ImageAlt string
+
+	CaptchaToken string
+	Captcha      string
+	PowToken     string
+	PowNonce     string
+}
+
+// postError explains why a post was refused, Code is a stable name for api clients
+type postError struct {
+	Code    string
+	Message string
+	Status  int
+}
+
+func (e *postError) Error() string {
+	return e.Message
+}
+
+func newPostError(code string, status int, format string, a ...any) *postError {
+	return &postError{Code: code, Message: fmt.Sprintf(format, a...), Status: status}
+}
+
 func NewPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, int64(Config.MaxUploadSize*102*1024))
+	r.Body = http.MaxBytesReader(w, r.Body, int64(Config.MaxUploadSize*1024*1024))
+
+	// staff
+	staff, err := checkAuth(r)
+	if err != nil {
+		if err == errInvalidSession {
+			http.Redirect(w, r, "/admin/logout", http.StatusSeeOther)
+			return
+		}
+		if err != http.ErrNoCookie {
+			writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	req := postRequest{
+		Parent:       r.PostFormValue("parent"),
+		Name:         r.PostFormValue("name"),
+		Subject:      r.PostFormValue("subject"),
+		Body:         r.PostFormValue("comment"),
+		Spoiler:      r.PostFormValue("spoiler") != "",
+		ImageAlt:     r.PostFormValue("alt"),
+		CaptchaToken: r.PostFormValue("captcha_token"),
+		Captcha:      r.PostFormValue("captcha"),
+		PowToken:     r.PostFormValue("pow_token"),
+		PowNonce:     r.PostFormValue("pow_nonce"),
+	}
+
+	f, _, err := r.FormFile("image")
+	if err != nil {
+		if err != http.ErrMissingFile {
+			writeError(w, r, fmt.Sprintf("failed to parse form file: %s", err), http.StatusBadRequest)
+			return
+		}
+	} else {
+		defer f.Close()
+		req.Image = f
+	}
 
-	// admin
-	var admin bool
-	if Config.AdminPassword != "" {
-		err := checkAuth(r)
+	post, id, perr := submitPost(r, staff, Token{}, req)
+	if perr != nil {
+		if perr.Code == "banned" {
+			http.Redirect(w, r, "/banned", http.StatusSeeOther)
+			return
+		}
+
+		writeError(w, r, perr.Message, perr.Status)
+		return
+	}
+
+	if post.Pending {
+		err = pendingT.Execute(w, post)
 		if err != nil {
-			if err == errInvalidSession {
-				http.Redirect(w, r, "/admin/logout", http.StatusSeeOther)
-				return
-			}
-			if err != http.ErrNoCookie {
-				writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
-				return
-			}
-		} else {
-			admin = true
+			writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
+			return
 		}
+
+		return
+	}
+
+	redirect := post.Parent
+	if post.IsThread() {
+		redirect = id
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/thread/%s", redirect), http.StatusFound)
+}
+
+// submitPost validates and stores a post for NewPost and the api. Posts made
+// with an api token skip the poster's cooldown since tokens are rate limited
+// on their own, and trusted tokens skip the captcha, proof of work and blocklists.
+func submitPost(r *http.Request, staff Staff, token Token, req postRequest) (Post, string, *postError) {
+	trusted := staff.Name != "" || token.HasScope(ScopeTrusted)
+
+	if Config.AdminPostOnly && staff.Name == "" {
+		return Post{}, "", newPostError("staff_only", http.StatusForbidden, "only staff may post")
+	}
+	if flood.Mode() == "staff" && staff.Name == "" {
+		return Post{}, "", newPostError("flood", http.StatusServiceUnavailable, "posting is temporarily limited to staff")
 	}
 
 	// poster
 	identity, err := deriveIdentity(r)
 	if err != nil {
-		writeError(w, r, fmt.Sprintf("failed to derive identity: %s", err), http.StatusInternalServerError)
-		return
+		return Post{}, "", newPostError("internal", http.StatusInternalServerError, "failed to derive identity: %s", err)
 	}
 
-	poster, err := posters.Get(identity)
+	poster, err := getPoster(r, identity)
 	if err != nil && err != ErrUnknownPoster {
-		writeError(w, r, fmt.Sprintf("failed to look up poster info: %s", err), http.StatusInternalServerError)
-		return
+		return Post{}, "", newPostError("internal", http.StatusInternalServerError, "failed to look up poster info: %s", err)
 	}
-	if poster.IsBanned() {
-		writeError(w, r, "you are banned", http.StatusForbidden)
-		return
+
+	banned, err := isBanned(r, poster)
+	if err != nil {
+		return Post{}, "", newPostError("internal", http.StatusInternalServerError, "failed to look up bans: %s", err)
 	}
-	if poster.LastPost.Add(time.Second * time.Duration(Config.PostCooldown)).After(time.Now()) {
-		writeError(w, r, "you are posting too quickly", http.StatusTooManyRequests)
-		return
+	if banned {
+		return Post{}, "", newPostError("banned", http.StatusForbidden, "you are banned")
+	}
+	if token.Name == "" && poster.LastPost.Add(time.Second*time.Duration(Config.PostCooldown)).After(time.Now()) {
+		return Post{}, "", newPostError("cooldown", http.StatusTooManyRequests, "you are posting too quickly")
+	}
+
+	var listed listing
+	if !trusted {
+		listed, err = checkBlocklists(r, identity)
+		if err != nil {
+			return Post{}, "", newPostError("internal", http.StatusInternalServerError, "failed to check blocklists: %s", err)
+		}
+		if listed.Block {
+			return Post{}, "", newPostError("blocked", http.StatusForbidden, "posting from your address is blocked, it is listed on %s", strings.Join(listed.Lists, ", "))
+		}
 	}
 
 	// post
 	var post Post
 
 	post.Poster = identity
-	if admin {
-		post.Poster = "admin"
+	if staff.Name != "" {
+		post.Poster = ""
+		post.Staff = staff.Name
 	}
 
-	post.Name = strings.TrimSpace(r.PostFormValue("name"))
+	post.Name = strings.TrimSpace(req.Name)
 	if !utf8.ValidString(post.Name) || utf8.RuneCountInString(post.Name) > Config.MaxNameSize {
-		writeError(w, r, "invalid name", http.StatusBadRequest)
-		return
+		return Post{}, "", newPostError("invalid_name", http.StatusBadRequest, "invalid name")
 	}
 
-	post.Subject = strings.TrimSpace(r.PostFormValue("subject"))
+	post.Subject = strings.TrimSpace(req.Subject)
 	if !utf8.ValidString(post.Subject) || utf8.RuneCountInString(post.Subject) > Config.MaxSubjectSize {
-		writeError(w, r, "invalid subject", http.StatusBadRequest)
-		return
+		return Post{}, "", newPostError("invalid_subject", http.StatusBadRequest, "invalid subject")
 	}
 
-	post.Body = strings.TrimSpace(r.PostFormValue("comment"))
+	post.Body = strings.TrimSpace(req.Body)
 	if !utf8.ValidString(post.Body) || utf8.RuneCountInString(post.Body) > Config.MaxCommentSize {
-		writeError(w, r, "invalid comment", http.StatusBadRequest)
-		return
+		return Post{}, "", newPostError("invalid_comment", http.StatusBadRequest, "invalid comment")
+	}
+
+	post.Parent = req.Parent
+	if post.Parent != "" {
+		parent, err := posts.Get(post.Parent)
+		if err != nil && err != ErrUnknownPost {
+			return Post{}, "", newPostError("internal", http.StatusInternalServerError, "failed to fetch thread: %s", err)
+		}
+		if err == ErrUnknownPost || !parent.IsThread() || !isVisible(parent, staff, identity) {
+			return Post{}, "", newPostError("not_found", http.StatusNotFound, "thread not found")
+		}
+	}
+	if post.IsThread() && flood.Mode() == "threads" && staff.Name == "" {
+		return Post{}, "", newPostError("flood", http.StatusServiceUnavailable, "new threads are temporarily disabled")
 	}
 
-	post.Parent = r.PostFormValue("parent")
 	post.Posted = time.Now()
 
-	// handle image
-	f, _, err := r.FormFile("image")
-	if err != nil {
-		if err != http.ErrMissingFile {
-			writeError(w, r, fmt.Sprintf("failed to parse form file: %s", err), http.StatusBadRequest)
-			return
+	// captcha
+	if !trusted && (needsCaptcha(poster, post.IsThread()) || listed.Captcha) {
+		err = checkCaptcha(req.CaptchaToken, req.Captcha, identity)
+		if err != nil {
+			code := "captcha_invalid"
+			if err == errCaptchaMissing {
+				code = "captcha_required"
+			}
+
+			return Post{}, "", newPostError(code, http.StatusForbidden, "%s", err)
 		}
-	} else {
+	}
+
+	// proof of work
+	if !trusted && Config.ProofOfWork {
+		err = checkPow(req.PowToken, req.PowNonce, identity)
+		if err != nil {
+			code := "pow_invalid"
+			if err == errPowMissing {
+				code = "pow_required"
+			}
+
+			return Post{}, "", newPostError(code, http.StatusForbidden, "%s", err)
+		}
+	}
+
+	// filters
+	if staff.Name == "" {
+		filter, matched, err := applyFilters(&post)
+		if err != nil {
+			return Post{}, "", newPostError("internal", http.StatusInternalServerError, "failed to apply filters: %s", err)
+		}
+
+		if matched {
+			switch filter.Action {
+			case FilterHold:
+				post.Pending = true
+			case FilterReject:
+				reason := "your post was rejected"
+				if filter.Reason != "" {
+					reason = fmt.Sprintf("your post was rejected: %s", filter.Reason)
+				}
+
+				return Post{}, "", newPostError("rejected", http.StatusBadRequest, "%s", reason)
+			case FilterBan:
+				filterBan(&poster, filter, post)
+
+				err = posters.Add(identity, poster)
+				if err != nil {
+					return Post{}, "", newPostError("internal", http.StatusInternalServerError, "failed to insert poster: %s", err)
+				}
+
+				writeLog(r, fmt.Sprintf("banned by filter \"%s\" until %s", filter.Pattern, banUntil(poster.BanExpiry)))
+				writeAudit(Staff{}, AuditEntry{Action: "ban", Poster: identity, Reason: poster.BanReason, Snapshot: &post})
+
+				return Post{}, "", newPostError("banned", http.StatusForbidden, "you are banned")
+			}
+		}
+	}
+
+	// handle image
+	if req.Image != nil {
 		post.Image = true
+		post.Spoiler = req.Spoiler
 
-		img, _, err := image.Decode(f)
+		post.ImageAlt = strings.TrimSpace(req.ImageAlt)
+		if !utf8.ValidString(post.ImageAlt) || utf8.RuneCountInString(post.ImageAlt) > Config.MaxAltSize {
+			return Post{}, "", newPostError("invalid_alt", http.StatusBadRequest, "invalid image description")
+		}
+
+		cfg, format, err := image.DecodeConfig(req.Image)
 		if err != nil {
-			writeError(w, r, fmt.Sprintf("failed to decode image file: %s", err), http.StatusBadRequest)
-			return
+			return Post{}, "", newPostError("invalid_image", http.StatusBadRequest, "failed to decode image file: %s", err)
+		}
+		if !isImageType(format) {
+			return Post{}, "", newPostError("invalid_image", http.StatusBadRequest, "unsupported image format \"%s\"", format)
+		}
+		if cfg.Width*cfg.Height > maxImagePixels {
+			return Post{}, "", newPostError("invalid_image", http.StatusBadRequest, "image is too large, it may be at most %d megapixels", maxImagePixels/1000000)
 		}
 
-		err = post.WriteImage(img)
+		_, err = req.Image.Seek(0, io.SeekStart)
 		if err != nil {
-			writeError(w, r, fmt.Sprintf("failed to write image files: %s", err), http.StatusInternalServerError)
-			return
+			return Post{}, "", newPostError("internal", http.StatusInternalServerError, "failed to rewind image file: %s", err)
+		}
+
+		if format == "gif" {
+			var data []byte
+			data, err = io.ReadAll(req.Image)
+			if err != nil {
+				return Post{}, "", newPostError("internal", http.StatusInternalServerError, "failed to read image file: %s", err)
+			}
+
+			// count frames before decoding them, every one is held in memory at full size
+			var frames int
+			frames, err = gifFrames(data)
+			if err != nil {
+				return Post{}, "", newPostError("invalid_image", http.StatusBadRequest, "failed to decode image file: %s", err)
+			}
+			if frames*cfg.Width*cfg.Height > maxAnimationPixels {
+				return Post{}, "", newPostError("invalid_image", http.StatusBadRequest, "animation is too large, it has %d frames", frames)
+			}
+
+			var g *gif.GIF
+			g, err = gif.DecodeAll(bytes.NewReader(data))
+			if err != nil {
+				return Post{}, "", newPostError("invalid_image", http.StatusBadRequest, "failed to decode image file: %s", err)
+			}
+
+			if len(g.Image) > 1 {
+				err = post.WriteAnimation(media, data, g)
+			} else {
+				err = post.WriteImage(media, g.Image[0])
+			}
+		} else {
+			var img image.Image
+			img, _, err = image.Decode(req.Image)
+			if err != nil {
+				return Post{}, "", newPostError("invalid_image", http.StatusBadRequest, "failed to decode image file: %s", err)
+			}
+
+			err = post.WriteImage(media, img)
+		}
+		if err != nil {
+			return Post{}, "", newPostError("internal", http.StatusInternalServerError, "failed to write image files: %s", err)
 		}
 	}
 
 	if post.Body == "" && !post.Image {
-		writeError(w, r, "a comment or image is required", http.StatusBadRequest)
-		return
+		return Post{}, "", newPostError("empty_post", http.StatusBadRequest, "a comment or image is required")
 	}
 
-	err = posters.Add(identity, Poster{LastPost: post.Posted})
-	if err != nil {
-		writeError(w, r, fmt.Sprintf("failed to insert poster: %s", err), http.StatusInternalServerError)
-		return
+	approved := poster.IsApproved()
+
+	// shadow banned posts are held like any other so the poster can't tell,
+	// but they're left out of the queue since staff would just reject them
+	post.Shadow = staff.Name == "" && poster.IsShadowBanned()
+
+	if staff.Name == "" && !post.Pending {
+		switch Config.Moderation {
+		case "threads":
+			post.Pending = post.IsThread()
+		case "all":
+			post.Pending = true
+		case "new":
+			post.Pending = !approved
+		}
+
+		// addresses on blocklists are held whatever the moderation mode
+		post.Pending = post.Pending || listed.Hold
 	}
 
-	var id string
-	id, err = posts.Add(post)
+	poster.LastPost = post.Posted
+	poster.Held = !approved && (post.Pending || post.Shadow)
+
+	err = posters.Add(identity, poster)
 	if err != nil {
-		writeError(w, r, fmt.Sprintf("failed to insert post: %s", err), http.StatusInternalServerError)
-		return
+		return Post{}, "", newPostError("internal", http.StatusInternalServerError, "failed to insert poster: %s", err)
 	}
 
-	redirect := post.Parent
-	if post.IsThread() {
-		redirect = id
+	id, err := posts.Add(post)
+	if err != nil {
+		return Post{}, "", newPostError("internal", http.StatusInternalServerError, "failed to insert post: %s", err)
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/thread/%s", redirect), http.StatusFound)
-
 	postTypeText := "thread"
 	if !post.IsThread() {
 		postTypeText = fmt.Sprintf("reply to thread \"%s\"", post.Parent)
 	}
 
-	writeLog(r, fmt.Sprintf("created new %s with id \"%s\"", postTypeText, post.ID()))
+	if post.Pending {
+		postTypeText = "pending " + postTypeText
+	}
+	if post.Shadow {
+		postTypeText = "shadow banned " + postTypeText
+	}
+
+	viaText := ""
+	if token.Name != "" {
+		viaText = fmt.Sprintf(" with api token \"%s\"", token.Name)
+	}
+
+	writeLog(r, fmt.Sprintf("created new %s with id \"%s\"%s", postTypeText, post.ID(), viaText))
+
+	if staff.Name == "" {
+		reason, triggered := flood.Record(post.IsThread())
+		if triggered {
+			writeLog(r, fmt.Sprintf("flood protection enabled: %s", reason))
+			writeAudit(Staff{}, AuditEntry{Action: "flood protection", Reason: reason})
+		}
+	}
+
+	return post, id, nil
+}
+
+// filterBan replaces any existing ban on the poster, including a shadow ban, with an
+// open ban for the filter that matched post
+func filterBan(poster *Poster, filter Filter, post Post) {
+	poster.Unban()
+	poster.BanTime = time.Now()
+	poster.BanReason = filter.Reason
+	banPost := post.WithoutPosters()
+	poster.BanPost = &banPost
+	if filter.BanDuration > 0 {
+		poster.BanExpiry = poster.BanTime.Add(filter.BanDuration)
+	}
+}
+
+// gifFrames counts the frames of a gif by walking its blocks, without decoding any image data
+func gifFrames(data []byte) (int, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+
+	// header and logical screen descriptor
+	header := make([]byte, 13)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return 0, err
+	}
+	if header[10]&0x80 != 0 {
+		_, err = r.Discard(3 << (header[10]&0x07 + 1))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var frames int
+	for {
+		block, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		switch block {
+		case 0x21: // extension
+			_, err = r.ReadByte() // label
+		case 0x2c: // image descriptor
+			frames++
+
+			desc := make([]byte, 9)
+			_, err = io.ReadFull(r, desc)
+			if err == nil && desc[8]&0x80 != 0 {
+				_, err = r.Discard(3 << (desc[8]&0x07 + 1))
+			}
+			if err == nil {
+				_, err = r.ReadByte() // lzw minimum code size
+			}
+		case 0x3b: // trailer
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("gif: unknown block type 0x%02x", block)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		// both are followed by data sub-blocks ending with an empty one
+		for {
+			size, err := r.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			if size == 0 {
+				break
+			}
+
+			_, err = r.Discard(int(size))
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
 }
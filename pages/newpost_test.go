@@ -0,0 +1,61 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/patapancakes/tanuki/db"
+)
+
+func TestFilterBan(t *testing.T) {
+	tests := []struct {
+		name   string
+		poster Poster
+		filter Filter
+		expiry bool
+	}{
+		{"clean poster", Poster{}, Filter{Reason: "spam"}, false},
+		{"timed", Poster{}, Filter{Reason: "spam", BanDuration: time.Hour}, true},
+		{"shadow banned", Poster{BanTime: time.Now().Add(-time.Hour), BanReason: "quiet", BanShadow: true}, Filter{Reason: "spam"}, false},
+		{"shadow banned with expiry", Poster{BanTime: time.Now().Add(-time.Hour), BanExpiry: time.Now().Add(time.Hour), BanShadow: true}, Filter{Reason: "spam"}, false},
+	}
+
+	for _, tt := range tests {
+		poster := tt.poster
+		filterBan(&poster, tt.filter, Post{Body: "spam", Poster: "abc"})
+
+		if !poster.IsBanned() {
+			t.Errorf("%s: IsBanned() = false, want true", tt.name)
+		}
+		if poster.IsShadowBanned() {
+			t.Errorf("%s: IsShadowBanned() = true, want false", tt.name)
+		}
+		if poster.BanReason != tt.filter.Reason {
+			t.Errorf("%s: BanReason = %q, want %q", tt.name, poster.BanReason, tt.filter.Reason)
+		}
+		if !poster.BanExpiry.IsZero() != tt.expiry {
+			t.Errorf("%s: BanExpiry = %s, want expiry %t", tt.name, poster.BanExpiry, tt.expiry)
+		}
+		if poster.BanPost == nil || poster.BanPost.Poster != "" {
+			t.Errorf("%s: BanPost = %+v, want the post without its poster", tt.name, poster.BanPost)
+		}
+	}
+}
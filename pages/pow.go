@@ -0,0 +1,163 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	. "github.com/patapancakes/tanuki/config"
+)
+
+const (
+	powAudience = "pow"
+	powExpiry   = time.Minute * 10
+
+	// difficulty goes up a bit each time the number of posters active within
+	// the window doubles past powStep
+	powWindow = time.Minute * 10
+	powStep   = 4
+)
+
+var (
+	errPowMissing = errors.New("proof of work is required to post, please enable JavaScript")
+	errPowInvalid = errors.New("the proof of work has expired, please try again")
+	errPowFailed  = errors.New("the proof of work is incorrect, please try again")
+
+	spentPows tokenSet
+)
+
+type powClaims struct {
+	Difficulty int `json:"difficulty"`
+	jwt.RegisteredClaims
+}
+
+// powDifficulty scales the configured difficulty with recent post volume
+func powDifficulty() (int, error) {
+	active, err := posters.CountActive(time.Now().Add(-powWindow))
+	if err != nil {
+		return 0, err
+	}
+
+	difficulty := Config.PowDifficulty + bits.Len(uint(active/powStep))
+
+	return min(difficulty, max(Config.PowDifficulty, Config.PowMaxDifficulty)), nil
+}
+
+// powValid reports whether sha256(id:nonce) starts with at least difficulty zero bits
+func powValid(id string, nonce string, difficulty int) bool {
+	sum := sha256.Sum256([]byte(id + ":" + nonce))
+
+	var zeros int
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+
+	return zeros >= difficulty
+}
+
+func PowChallenge(w http.ResponseWriter, r *http.Request) {
+	if !Config.ProofOfWork {
+		writeError(w, r, "proof of work is disabled", http.StatusNotFound)
+		return
+	}
+
+	identity, err := deriveIdentity(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to derive identity: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	difficulty, err := powDifficulty()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to determine difficulty: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	key, err := os.ReadFile("data/session.key")
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to read session signing key: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	claims := powClaims{
+		Difficulty: difficulty,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        base64.RawURLEncoding.EncodeToString(id),
+			Audience:  jwt.ClaimStrings{powAudience},
+			Subject:   identity,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(powExpiry)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to sign challenge: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	json.NewEncoder(w).Encode(struct {
+		Token      string `json:"token"`
+		ID         string `json:"id"`
+		Difficulty int    `json:"difficulty"`
+	}{token, claims.ID, difficulty})
+}
+
+// checkPow verifies a proof of work, each challenge can only be used once
+func checkPow(token string, nonce string, identity string) error {
+	if token == "" || nonce == "" {
+		return errPowMissing
+	}
+
+	var claims powClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (any, error) {
+		return os.ReadFile("data/session.key")
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(powAudience), jwt.WithExpirationRequired())
+	if err != nil || claims.Subject != identity {
+		return errPowInvalid
+	}
+
+	if !powValid(claims.ID, nonce, claims.Difficulty) {
+		return errPowFailed
+	}
+
+	if !spentPows.Spend(claims.ID, claims.ExpiresAt.Time) {
+		return errPowInvalid
+	}
+
+	return nil
+}
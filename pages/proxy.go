@@ -0,0 +1,207 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	. "github.com/patapancakes/tanuki/config"
+)
+
+var trustedProxies []netip.Prefix
+
+// parseTrustedProxies reads the trusted proxy addresses and ranges, trusting
+// loopback when the option isn't set at all as older versions did
+func parseTrustedProxies() error {
+	list := Config.TrustedProxies
+	if list == nil {
+		list = []string{"127.0.0.0/8", "::1/128"}
+	}
+
+	trustedProxies = nil
+	for _, text := range list {
+		prefix, err := netip.ParsePrefix(text)
+		if err != nil {
+			addr, err := netip.ParseAddr(text)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy \"%s\"", text)
+			}
+
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		trustedProxies = append(trustedProxies, prefix.Masked())
+	}
+
+	switch http.CanonicalHeaderKey(Config.ProxyHeader) {
+	case "", "X-Forwarded-For", "X-Real-Ip", "Forwarded":
+	default:
+		return fmt.Errorf("unknown proxy header \"%s\"", Config.ProxyHeader)
+	}
+
+	return nil
+}
+
+// IsTrustedProxy reports whether addr belongs to a proxy whose forwarding information can be believed
+func IsTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientAddr returns the address of the client, taken from the configured
+// forwarding header when the request came through a trusted proxy
+func clientAddr(r *http.Request) (netip.Addr, error) {
+	addrport, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	peer := addrport.Addr().Unmap()
+	if !IsTrustedProxy(peer) {
+		return peer, nil
+	}
+
+	switch http.CanonicalHeaderKey(Config.ProxyHeader) {
+	case "X-Real-Ip":
+		if r.Header.Get("X-Real-IP") == "" {
+			return peer, nil
+		}
+
+		addr, err := parseHop(r.Header.Get("X-Real-IP"))
+		if err != nil {
+			return peer, nil
+		}
+
+		return addr, nil
+	case "Forwarded":
+		return forwardedClient(peer, parseForwarded(strings.Join(r.Header.Values("Forwarded"), ","))), nil
+	}
+
+	if len(r.Header.Values("X-Forwarded-For")) == 0 {
+		return peer, nil
+	}
+
+	return forwardedClient(peer, strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")), nil
+}
+
+// forwardedClient walks a chain of forwarded addresses from the nearest hop, where
+// each trusted proxy vouches for the hop before it, and returns the first it can't trust.
+// Hops that aren't addresses ("unknown", obfuscated identifiers, elements without a "for"
+// parameter) end the walk at the last trusted address, as nothing before them can be vouched for.
+func forwardedClient(peer netip.Addr, hops []string) netip.Addr {
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := parseHop(hops[i])
+		if err != nil {
+			return client
+		}
+
+		client = addr
+		if !IsTrustedProxy(addr) {
+			return addr
+		}
+	}
+
+	return client
+}
+
+// parseHop parses a forwarded address, which may have a port and IPv6 brackets
+func parseHop(hop string) (netip.Addr, error) {
+	hop = strings.TrimSpace(hop)
+
+	addrport, err := netip.ParseAddrPort(hop)
+	if err == nil {
+		return addrport.Addr().Unmap(), nil
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid forwarded address \"%s\"", hop)
+	}
+
+	return addr.Unmap(), nil
+}
+
+// parseForwarded returns the "for" parameter of every element of a Forwarded header (RFC 7239)
+func parseForwarded(header string) []string {
+	var hops []string
+	for _, element := range splitQuoted(header, ',') {
+		var hop string
+		for _, pair := range splitQuoted(element, ';') {
+			key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			if strings.EqualFold(key, "for") {
+				hop = unquote(value)
+			}
+		}
+
+		hops = append(hops, hop)
+	}
+
+	return hops
+}
+
+// splitQuoted splits s at every sep outside of a quoted string
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+
+	var quoted, escaped bool
+	var start int
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// unquote removes the quotes and escapes of a quoted string, leaving tokens untouched
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,110 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/patapancakes/tanuki/config"
+)
+
+func TestClientAddr(t *testing.T) {
+	defer func(c ConfigFile) {
+		Config = c
+		parseTrustedProxies()
+	}(Config)
+
+	Config.TrustedProxies = []string{"10.0.0.0/8", "::1", "2001:db8:ff::/48"}
+
+	tests := []struct {
+		name   string
+		header string // Config.ProxyHeader
+		remote string
+		values []string // header lines
+		want   string
+	}{
+		// X-Forwarded-For
+		{"untrusted peer", "", "198.51.100.50:1234", []string{"192.0.2.1"}, "198.51.100.50"},
+		{"no header", "", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"single hop", "", "10.0.0.1:1234", []string{"192.0.2.1"}, "192.0.2.1"},
+		{"chained", "", "10.0.0.1:1234", []string{"192.0.2.1, 10.0.0.2, 10.0.0.3"}, "192.0.2.1"},
+		{"spoofed leftmost", "", "10.0.0.1:1234", []string{"1.2.3.4, 192.0.2.1"}, "192.0.2.1"},
+		{"spoofed trusted leftmost", "", "10.0.0.1:1234", []string{"10.0.0.9, 192.0.2.1, 10.0.0.2"}, "192.0.2.1"},
+		{"all trusted", "", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"multiple lines", "", "10.0.0.1:1234", []string{"1.2.3.4", "192.0.2.1, 10.0.0.2"}, "192.0.2.1"},
+		{"ipv4 with port", "", "10.0.0.1:1234", []string{"192.0.2.1:8080"}, "192.0.2.1"},
+		{"ipv6", "", "10.0.0.1:1234", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"ipv6 brackets", "", "10.0.0.1:1234", []string{"[2001:db8::1]"}, "2001:db8::1"},
+		{"ipv6 brackets and port", "", "10.0.0.1:1234", []string{"[2001:db8::1]:4711"}, "2001:db8::1"},
+		{"ipv4 mapped", "", "10.0.0.1:1234", []string{"::ffff:192.0.2.1"}, "192.0.2.1"},
+		{"ipv6 peer", "", "[::1]:1234", []string{"192.0.2.1"}, "192.0.2.1"},
+		{"ipv6 proxy range", "", "[2001:db8:ff::2]:1234", []string{"192.0.2.1, 2001:db8:ff::1"}, "192.0.2.1"},
+		{"garbage leftmost", "", "10.0.0.1:1234", []string{"garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"garbage nearest", "", "10.0.0.1:1234", []string{"192.0.2.1, garbage"}, "10.0.0.1"},
+		{"empty hop", "", "10.0.0.1:1234", []string{"192.0.2.1,"}, "10.0.0.1"},
+
+		// Forwarded
+		{"forwarded", "Forwarded", "10.0.0.1:1234", []string{"for=192.0.2.1;proto=https"}, "192.0.2.1"},
+		{"forwarded chained", "Forwarded", "10.0.0.1:1234", []string{"for=1.2.3.4, for=192.0.2.1;by=10.0.0.1, for=10.0.0.2"}, "192.0.2.1"},
+		{"forwarded multiple lines", "Forwarded", "10.0.0.1:1234", []string{"for=1.2.3.4", "for=192.0.2.1, for=10.0.0.2"}, "192.0.2.1"},
+		{"forwarded key case", "Forwarded", "10.0.0.1:1234", []string{"For=192.0.2.1"}, "192.0.2.1"},
+		{"forwarded quoted ipv6", "Forwarded", "10.0.0.1:1234", []string{`for="[2001:db8::1]:4711"`}, "2001:db8::1"},
+		{"forwarded quoted separators", "Forwarded", "10.0.0.1:1234", []string{`for=192.0.2.1;ext="a,b;c=d", for=10.0.0.2`}, "192.0.2.1"},
+		{"forwarded quoted escapes", "Forwarded", "10.0.0.1:1234", []string{`for="192.0.2.\1"`}, "192.0.2.1"},
+		{"forwarded unknown", "Forwarded", "10.0.0.1:1234", []string{"for=unknown, for=10.0.0.2"}, "10.0.0.2"},
+		{"forwarded obfuscated", "Forwarded", "10.0.0.1:1234", []string{"for=192.0.2.1, for=_hidden"}, "10.0.0.1"},
+		{"forwarded without for", "Forwarded", "10.0.0.1:1234", []string{"proto=https;by=10.0.0.1"}, "10.0.0.1"},
+		{"forwarded untrusted peer", "Forwarded", "198.51.100.50:1234", []string{"for=192.0.2.1"}, "198.51.100.50"},
+
+		// X-Real-IP
+		{"real ip", "X-Real-IP", "10.0.0.1:1234", []string{"192.0.2.1"}, "192.0.2.1"},
+		{"real ip garbage", "X-Real-IP", "10.0.0.1:1234", []string{"garbage"}, "10.0.0.1"},
+		{"real ip missing", "X-Real-IP", "10.0.0.1:1234", nil, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		Config.ProxyHeader = tt.header
+
+		err := parseTrustedProxies()
+		if err != nil {
+			t.Fatalf("parseTrustedProxies: %s", err)
+		}
+
+		name := tt.header
+		if name == "" {
+			name = "X-Forwarded-For"
+		}
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for _, value := range tt.values {
+			r.Header.Add(name, value)
+		}
+
+		addr, err := clientAddr(r)
+		if err != nil {
+			t.Errorf("%s: clientAddr: %s", tt.name, err)
+			continue
+		}
+		if addr.String() != tt.want {
+			t.Errorf("%s: clientAddr = %s, want %s", tt.name, addr, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	. "github.com/patapancakes/tanuki/db"
+)
+
+type QueueData struct {
+	Staff Staff
+
+	Posts PostData
+}
+
+var (
+	queueT   *template.Template
+	pendingT *template.Template
+)
+
+func Queue(w http.ResponseWriter, r *http.Request) {
+	var qd QueueData
+	var err error
+
+	qd.Staff, err = checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !qd.Staff.Role.CanDelete() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	all, err := posts.GetAll()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch posts: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	for _, thread := range all {
+		if thread.IsDeleted() {
+			continue
+		}
+		if thread.Pending && !thread.Shadow {
+			qd.Posts = append(qd.Posts, thread)
+		}
+
+		for _, reply := range thread.Replies {
+			if !reply.Pending || reply.Shadow || reply.IsDeleted() {
+				continue
+			}
+
+			qd.Posts = append(qd.Posts, reply)
+		}
+	}
+
+	err = queueT.Execute(w, qd)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func AdminApprove(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanDelete() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	post, err := posts.Get(r.FormValue("id"))
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch post: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if !post.Pending || post.Shadow {
+		writeError(w, r, "post is not awaiting approval", http.StatusBadRequest)
+		return
+	}
+
+	post.Pending = false
+
+	err = posts.Update(post)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to update post: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if post.Poster != "" {
+		poster, err := posters.Get(post.Poster)
+		if err != nil && err != ErrUnknownPoster {
+			writeError(w, r, fmt.Sprintf("failed to look up poster info: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		poster.Held = false
+
+		err = posters.Add(post.Poster, poster)
+		if err != nil {
+			writeError(w, r, fmt.Sprintf("failed to insert poster: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/admin/queue", http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("approved post with id \"%s\"", post.ID()))
+	writeAudit(staff, AuditEntry{Action: "approve", Post: post.ID(), Poster: post.Poster})
+}
+
+func AdminReject(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanDelete() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	post, err := posts.Get(r.FormValue("id"))
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch post: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if !post.Pending || post.Shadow {
+		writeError(w, r, "post is not awaiting approval", http.StatusBadRequest)
+		return
+	}
+
+	err = posts.Delete(post.ID())
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to delete post: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/queue", http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("rejected post with id \"%s\"", post.ID()))
+	writeAudit(staff, AuditEntry{Action: "reject", Post: post.ID(), Poster: post.Poster, Reason: r.FormValue("reason"), Snapshot: &post})
+}
@@ -0,0 +1,155 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"time"
+
+	. "github.com/patapancakes/tanuki/config"
+	. "github.com/patapancakes/tanuki/db"
+)
+
+type ReportFormData struct {
+	Post    Post
+	Reasons []string
+}
+
+var reportT *template.Template
+
+// reportReasons lists the reasons a post can be reported for, one per site rule
+func reportReasons() []string {
+	return append(slices.Clone(Config.SiteRules), "Other")
+}
+
+func ReportPost(w http.ResponseWriter, r *http.Request) {
+	var rd ReportFormData
+
+	identity, err := deriveIdentity(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to derive identity: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	rd.Post, err = posts.Get(r.PathValue("id"))
+	if err == nil && !isVisible(rd.Post, Staff{}, identity) {
+		err = ErrUnknownPost
+	}
+	if err != nil {
+		if err == ErrUnknownPost {
+			writeError(w, r, "post not found", http.StatusNotFound)
+			return
+		}
+
+		writeError(w, r, fmt.Sprintf("failed to fetch post: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	rd.Post = redact(rd.Post, Staff{})
+	rd.Post.Replies = filterPosts(rd.Post.Replies, Staff{}, identity)
+	rd.Reasons = reportReasons()
+
+	err = reportT.Execute(w, rd)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func NewReport(w http.ResponseWriter, r *http.Request) {
+	identity, err := deriveIdentity(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to derive identity: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	poster, err := getPoster(r, identity)
+	if err != nil && err != ErrUnknownPoster {
+		writeError(w, r, fmt.Sprintf("failed to look up poster info: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	banned, err := isBanned(r, poster)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to look up bans: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if banned {
+		http.Redirect(w, r, "/banned", http.StatusSeeOther)
+		return
+	}
+	if poster.LastReport.Add(time.Second * time.Duration(Config.ReportCooldown)).After(time.Now()) {
+		writeError(w, r, "you are reporting too quickly", http.StatusTooManyRequests)
+		return
+	}
+
+	post, err := posts.Get(r.PostFormValue("id"))
+	if err == nil && !isVisible(post, Staff{}, identity) {
+		err = ErrUnknownPost
+	}
+	if err != nil {
+		if err == ErrUnknownPost {
+			writeError(w, r, "post not found", http.StatusNotFound)
+			return
+		}
+
+		writeError(w, r, fmt.Sprintf("failed to fetch post: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if post.IsStaff() {
+		writeError(w, r, "staff posts cannot be reported", http.StatusBadRequest)
+		return
+	}
+
+	report := Report{Reason: r.PostFormValue("reason"), Time: time.Now()}
+	if !slices.Contains(reportReasons(), report.Reason) {
+		writeError(w, r, "invalid reason", http.StatusBadRequest)
+		return
+	}
+
+	poster.LastReport = report.Time
+
+	err = posters.Add(identity, poster)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to insert poster: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	// reports from shadow banned posters are quietly dropped
+	if !poster.IsShadowBanned() {
+		err = reports.Add(post.ID(), identity, report)
+		if err != nil {
+			writeError(w, r, fmt.Sprintf("failed to insert report: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	redirect := post.Parent
+	if post.IsThread() {
+		redirect = post.ID()
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/thread/%s", redirect), http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("reported post with id \"%s\" for reason \"%s\"", post.ID(), report.Reason))
+}
@@ -0,0 +1,134 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"time"
+
+	. "github.com/patapancakes/tanuki/db"
+)
+
+type ReportedPost struct {
+	Post    Post
+	Count   int
+	Reasons map[string]int
+	Latest  time.Time
+}
+
+type ReportsData struct {
+	Staff Staff
+
+	Reports []ReportedPost
+}
+
+var reportsT *template.Template
+
+func Reports(w http.ResponseWriter, r *http.Request) {
+	var rd ReportsData
+	var err error
+
+	rd.Staff, err = checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !rd.Staff.Role.CanDelete() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	all, err := reports.GetAll()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch reports: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	for id, postReports := range all {
+		post, err := posts.Get(id)
+		if err != nil {
+			if err != ErrUnknownPost {
+				writeError(w, r, fmt.Sprintf("failed to fetch post: %s", err), http.StatusInternalServerError)
+				return
+			}
+
+			// the post was purged, so are its reports
+			err = reports.Delete(id)
+			if err != nil {
+				writeError(w, r, fmt.Sprintf("failed to delete reports: %s", err), http.StatusInternalServerError)
+				return
+			}
+
+			continue
+		}
+		if post.IsDeleted() {
+			continue
+		}
+
+		reported := ReportedPost{Post: post, Count: len(postReports), Reasons: make(map[string]int)}
+		for _, report := range postReports {
+			reported.Reasons[report.Reason]++
+			if report.Time.After(reported.Latest) {
+				reported.Latest = report.Time
+			}
+		}
+
+		rd.Reports = append(rd.Reports, reported)
+	}
+
+	// most reported first, then most recently reported
+	slices.SortFunc(rd.Reports, func(a, b ReportedPost) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), b.Latest.Compare(a.Latest))
+	})
+
+	err = reportsT.Execute(w, rd)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func AdminDismissReports(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanDelete() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	id := r.FormValue("id")
+
+	err = reports.Delete(id)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to delete reports: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("dismissed reports on post with id \"%s\"", id))
+	writeAudit(staff, AuditEntry{Action: "dismiss reports", Post: id})
+}
@@ -23,48 +23,70 @@ import (
 	"html/template"
 	"net/http"
 
-	. "github.com/patapancakes/tanuki/config"
 	. "github.com/patapancakes/tanuki/db"
 )
 
 var threadT *template.Template
 
 type ThreadData struct {
-	Admin bool
+	Staff Staff
 
 	Post Post
+	Form PostForm
 }
 
 func Thread(w http.ResponseWriter, r *http.Request) {
 	var td ThreadData
+	var err error
 
-	if Config.AdminPassword != "" {
-		err := checkAuth(r)
-		if err != nil {
-			if err == errInvalidSession {
-				http.Redirect(w, r, "/admin/logout", http.StatusSeeOther)
-				return
-			}
-			if err != http.ErrNoCookie {
-				writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
-				return
-			}
-		} else {
-			td.Admin = true
+	td.Staff, err = checkAuth(r)
+	if err != nil {
+		if err == errInvalidSession {
+			http.Redirect(w, r, "/admin/logout", http.StatusSeeOther)
+			return
+		}
+		if err != http.ErrNoCookie {
+			writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+			return
 		}
 	}
 
-	var err error
 	td.Post, err = posts.Get(r.PathValue("id"))
 	if err != nil {
+		if err == ErrUnknownPost {
+			writeError(w, r, "post not found", http.StatusNotFound)
+			return
+		}
+
 		writeError(w, r, fmt.Sprintf("failed to fetch post: %s", err), http.StatusInternalServerError)
 		return
 	}
+
+	identity, err := deriveIdentity(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to derive identity: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if !isVisible(td.Post, td.Staff, identity) {
+		writeError(w, r, "post not found", http.StatusNotFound)
+		return
+	}
+
+	td.Post = redact(td.Post, td.Staff)
+	td.Post.Replies = filterPosts(td.Post.Replies, td.Staff, identity)
+
 	if !td.Post.IsThread() {
 		http.Redirect(w, r, fmt.Sprintf("/thread/%s#post_%s", td.Post.Parent, td.Post.ID()), http.StatusSeeOther)
 		return
 	}
 
+	td.Form, err = newPostForm(r, td.Staff, td.Post.ID())
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to prepare post form: %s", err), http.StatusInternalServerError)
+		return
+	}
+
 	err = threadT.Execute(w, td)
 	if err != nil {
 		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
@@ -0,0 +1,269 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	. "github.com/patapancakes/tanuki/config"
+	. "github.com/patapancakes/tanuki/db"
+)
+
+type TokensData struct {
+	Staff Staff
+
+	Tokens TokenData
+	Scopes []Scope
+	Secret string // only shown right after a token is created
+}
+
+// tokenLimiter counts posts made with each api token over the last hour
+type tokenLimiter struct {
+	mtx   sync.Mutex
+	posts map[string][]time.Time
+}
+
+var (
+	tokensT *template.Template
+
+	tokenLimits tokenLimiter
+)
+
+// Allow reports whether a token can still post under its hourly limit
+func (l *tokenLimiter) Allow(hash string, limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.posts == nil {
+		l.posts = make(map[string][]time.Time)
+	}
+
+	l.posts[hash] = prune(l.posts[hash], time.Now().Add(-time.Hour))
+
+	return len(l.posts[hash]) < limit
+}
+
+// Record counts a post made with a token towards its hourly limit
+func (l *tokenLimiter) Record(hash string, limit int) {
+	if limit <= 0 {
+		return
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.posts == nil {
+		l.posts = make(map[string][]time.Time)
+	}
+
+	l.posts[hash] = append(l.posts[hash], time.Now())
+}
+
+// checkToken looks up the api token a request is authorized with, the hash is empty if there isn't one
+func checkToken(r *http.Request) (Token, string, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return Token{}, "", nil
+	}
+
+	secret, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok {
+		return Token{}, "", ErrUnknownToken
+	}
+
+	hash := HashToken(strings.TrimSpace(secret))
+
+	token, err := tokens.Get(hash)
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	return token, hash, nil
+}
+
+func Tokens(w http.ResponseWriter, r *http.Request) {
+	var td TokensData
+	var err error
+
+	td.Staff, err = checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !td.Staff.Role.CanConfig() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	executeTokens(w, r, td)
+}
+
+func executeTokens(w http.ResponseWriter, r *http.Request, td TokensData) {
+	var err error
+
+	td.Tokens, err = tokens.GetAll()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch tokens: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	td.Scopes = Scopes
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	err = tokensT.Execute(w, td)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to execute template: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func AdminAddToken(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanConfig() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to parse request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	token := Token{
+		Name:    strings.TrimSpace(r.FormValue("name")),
+		Creator: staff.Name,
+		Created: time.Now(),
+	}
+
+	if token.Name == "" || !utf8.ValidString(token.Name) || utf8.RuneCountInString(token.Name) > Config.MaxNameSize {
+		writeError(w, r, "invalid name", http.StatusBadRequest)
+		return
+	}
+
+	for _, scope := range r.Form["scope"] {
+		if !Scope(scope).IsValid() {
+			writeError(w, r, fmt.Sprintf("invalid scope \"%s\"", scope), http.StatusBadRequest)
+			return
+		}
+
+		token.Scopes = append(token.Scopes, Scope(scope))
+	}
+	if !token.HasScope(ScopeThreads) && !token.HasScope(ScopeReplies) {
+		writeError(w, r, "a token needs to be able to post threads or replies", http.StatusBadRequest)
+		return
+	}
+
+	if r.FormValue("limit") != "" {
+		token.RateLimit, err = strconv.Atoi(r.FormValue("limit"))
+		if err != nil || token.RateLimit < 0 {
+			writeError(w, r, "invalid rate limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	secret, hash := NewToken()
+
+	err = tokens.Add(hash, token)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to insert token: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	executeTokens(w, r, TokensData{Staff: staff, Secret: secret})
+
+	writeLog(r, fmt.Sprintf("added api token \"%s\" with scopes \"%s\"", token.Name, joinScopes(token.Scopes)))
+	writeAudit(staff, AuditEntry{Action: "add token", Reason: fmt.Sprintf("%s (%s)", token.Name, joinScopes(token.Scopes))})
+}
+
+func AdminDeleteToken(w http.ResponseWriter, r *http.Request) {
+	staff, err := checkAuth(r)
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("authentication failed: %s", err), http.StatusUnauthorized)
+		return
+	}
+	if !staff.Role.CanConfig() {
+		writeError(w, r, "insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to parse request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	hashes, ok := r.Form["hash"]
+	if !ok {
+		writeError(w, r, "no tokens specified", http.StatusBadRequest)
+		return
+	}
+
+	all, err := tokens.GetAll()
+	if err != nil {
+		writeError(w, r, fmt.Sprintf("failed to fetch tokens: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	var names []string
+	for _, hash := range hashes {
+		err = tokens.Delete(hash)
+		if err != nil {
+			if err == ErrUnknownToken {
+				continue
+			}
+
+			writeError(w, r, fmt.Sprintf("failed to delete token: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		names = append(names, all[hash].Name)
+
+		writeAudit(staff, AuditEntry{Action: "delete token", Reason: all[hash].Name})
+	}
+
+	http.Redirect(w, r, "/admin/tokens", http.StatusSeeOther)
+
+	writeLog(r, fmt.Sprintf("deleted api token(s) \"%s\"", names))
+}
+
+func joinScopes(scopes []Scope) string {
+	var s []string
+	for _, scope := range scopes {
+		s = append(s, string(scope))
+	}
+
+	return strings.Join(s, ", ")
+}
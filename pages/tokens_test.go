@@ -0,0 +1,50 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pages
+
+import "testing"
+
+func TestTokenLimiter(t *testing.T) {
+	var l tokenLimiter
+
+	// failed posts only check the limit
+	for range 5 {
+		if !l.Allow("hash", 2) {
+			t.Fatalf("Allow before any post = false, want true")
+		}
+	}
+
+	l.Record("hash", 2)
+	if !l.Allow("hash", 2) {
+		t.Errorf("Allow after one post = false, want true")
+	}
+
+	l.Record("hash", 2)
+	if l.Allow("hash", 2) {
+		t.Errorf("Allow after two posts = true, want false")
+	}
+	if !l.Allow("other", 2) {
+		t.Errorf("Allow for another token = false, want true")
+	}
+
+	l.Record("unlimited", 0)
+	if len(l.posts["unlimited"]) != 0 {
+		t.Errorf("Record kept %d post(s) for an unlimited token, want 0", len(l.posts["unlimited"]))
+	}
+}
@@ -0,0 +1,108 @@
+/*
+	tanuki - a lightweight image bbs
+	Copyright (C) 2025  Pancakes (pancakes@mooglepowered.com)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// proxyV2 builds a version 2 header with the given command, family and address block
+func proxyV2(command, family byte, block []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(block)))
+
+	return append(header, block...)
+}
+
+// proxyV2Block builds the address block of a TCP header, ports follow both addresses
+func proxyV2Block(src, dst string, srcPort, dstPort uint16) []byte {
+	var block []byte
+	block = append(block, netip.MustParseAddr(src).AsSlice()...)
+	block = append(block, netip.MustParseAddr(dst).AsSlice()...)
+	block = binary.BigEndian.AppendUint16(block, srcPort)
+
+	return binary.BigEndian.AppendUint16(block, dstPort)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []byte
+		want    string // empty when no address is passed on
+		wantErr bool
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"), "192.0.2.1:56324", false},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 4711 443\r\n"), "[2001:db8::1]:4711", false},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "", false},
+		{"v1 unknown with addresses", []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"), "", false},
+		{"v1 missing crlf", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\n"), "", true},
+		{"v1 bad protocol", []byte("PROXY UDP4 192.0.2.1 192.0.2.2 56324 443\r\n"), "", true},
+		{"v1 bad address", []byte("PROXY TCP4 192.0.2.x 192.0.2.2 56324 443\r\n"), "", true},
+		{"v1 bad port", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 99999 443\r\n"), "", true},
+		{"v1 missing fields", []byte("PROXY TCP4 192.0.2.1\r\n"), "", true},
+		{"v1 too long", []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"), "", true},
+		{"v2 tcp4", proxyV2(1, 0x11, proxyV2Block("192.0.2.1", "192.0.2.2", 56324, 443)), "192.0.2.1:56324", false},
+		{"v2 tcp6", proxyV2(1, 0x21, proxyV2Block("2001:db8::1", "2001:db8::2", 4711, 443)), "[2001:db8::1]:4711", false},
+		{"v2 tlvs", proxyV2(1, 0x11, append(proxyV2Block("192.0.2.1", "192.0.2.2", 56324, 443), 0x04, 0x00, 0x01, 0x00)), "192.0.2.1:56324", false},
+		{"v2 local", proxyV2(0, 0x00, nil), "", false},
+		{"v2 unix", proxyV2(1, 0x31, make([]byte, 216)), "", false},
+		{"v2 udp", proxyV2(1, 0x12, proxyV2Block("192.0.2.1", "192.0.2.2", 53, 53)), "", false},
+		{"v2 bad version", append(append([]byte{}, proxyV2Signature...), 0x11, 0x11, 0x00, 0x00), "", true},
+		{"v2 short block", proxyV2(1, 0x11, []byte{192, 0, 2, 1}), "", true},
+		{"v2 truncated", proxyV2(1, 0x21, proxyV2Block("2001:db8::1", "2001:db8::2", 4711, 443))[:30], "", true},
+		{"no header", []byte("GET / HTTP/1.1\r\nHost: example\r\n\r\n"), "", true},
+		{"short", []byte("PRO"), "", true},
+	}
+
+	for _, tt := range tests {
+		const rest = "GET / HTTP/1.1\r\n"
+
+		r := bufio.NewReader(bytes.NewReader(append(tt.header, rest...)))
+
+		addr, err := readProxyHeader(r)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: readProxyHeader error = %v, want error %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		var got string
+		if addr != nil {
+			got = addr.String()
+		}
+		if got != tt.want {
+			t.Errorf("%s: readProxyHeader = %q, want %q", tt.name, got, tt.want)
+		}
+
+		// the connection carries on right after the header
+		b, _ := io.ReadAll(r)
+		if string(b) != rest {
+			t.Errorf("%s: read %q after the header, want %q", tt.name, b, rest)
+		}
+	}
+}